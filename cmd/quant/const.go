@@ -6,4 +6,18 @@ const (
 	TimeSlice = 5 * time.Minute
 	Symbol    = "BTC/USDT"
 	RunLoop   = true
+	MCPServe  = "" // 非空时只作为 MCP 服务端运行："stdio" 或 HTTP 监听地址（如 ":8090"，默认只监听本机）
+
+	MaxQuantity   = 0.01  // 单笔下单数量上限
+	MaxTrades     = 3     // 每个 TimeSlice 内最多下单次数
+	TradeApproval = false // 为 true 时下单和平仓前需在终端确认
+	ShadowTrade   = false // 为 true 时交易工具只记录不执行，用于验证新提示词
+	AuditFile     = "tool_audit.json"
+	StateFile     = "state.json" // 记忆等状态的快照文件
+
+	MemoryFile                = "memory.json"  // 长期记忆的快照文件
+	MemoryFlushInterval       = time.Minute    // 长期记忆写回文件的间隔
+	RecallMemories            = 3              // 每次决策时放入提示词的长期记忆条数
+	MemoryConsolidateInterval = time.Hour      // 检查并合并旧记忆的间隔
+	MemoryConsolidateAge      = 24 * time.Hour // 早于该时间的记忆会被合并为摘要
 )
@@ -1,35 +1,67 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
 )
 
 func main() {
-	if RunLoop {
-		for {
-			log.Println("Starting trading step...")
+	// 收到 SIGINT/SIGTERM 后结束当前交易步骤或 MCP 服务，然后保存状态和记忆再退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			startTime := time.Now()
-			if err := RunTradingStep(Symbol); err != nil {
-				log.Printf("Error: %v\n", err)
-			}
+	// 恢复上次保存的记忆，之后每次修改都写回文件
+	sm := state.GetInstance()
+	if err := sm.Persist(state.NewFileStore(StateFile), state.WithFlushOnChange()); err != nil {
+		log.Printf("failed to restore state: %v\n", err)
+	}
+	closeMemories := setupMemories()
 
-			log.Printf("Cost %.0f seconds\n", time.Now().Sub(startTime).Seconds())
+	err := run(ctx)
 
-			log.Printf("Sleeping %.0f minutes...\n", TimeSlice.Minutes())
+	// 先停止归档，归档会读取 state 并写入长期记忆
+	closeMemories()
+	if err := sm.Close(); err != nil {
+		log.Printf("failed to save state: %v\n", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-			time.Sleep(TimeSlice)
-		}
-	} else {
+// run 作为 MCP 服务端运行或执行交易循环，直到 ctx 取消
+func run(ctx context.Context) error {
+	if MCPServe != "" {
+		return ServeMCP(ctx, MCPServe)
+	}
+
+	for {
 		log.Println("Starting trading step...")
 
 		startTime := time.Now()
-
 		if err := RunTradingStep(Symbol); err != nil {
 			log.Printf("Error: %v\n", err)
 		}
 
 		log.Printf("Cost %.0f seconds\n", time.Now().Sub(startTime).Seconds())
+
+		if !RunLoop {
+			return nil
+		}
+
+		log.Printf("Sleeping %.0f minutes...\n", TimeSlice.Minutes())
+
+		select {
+		case <-ctx.Done():
+			log.Println("Shutting down...")
+			return nil
+		case <-time.After(TimeSlice):
+		}
 	}
 }
@@ -1,56 +1,80 @@
 package main
 
 import (
-	_ "embed"
-	"encoding/json"
+	"context"
+	"log"
+	"os"
 
+	"github.com/Cai-ki/cage/jsondb"
 	"github.com/Cai-ki/cage/llm/mcp"
+	"github.com/Cai-ki/cage/llm/mcp/packs"
 	"github.com/Cai-ki/cage/llm/mcp/state"
-	"github.com/Cai-ki/cage/quant"
 )
 
-//go:embed mcp.json
-var mcpString string
-
 func init() {
-	type futures_buy_market_args struct {
-		Symbol   string  `json:"symbol"`
-		Quantity float64 `json:"quantity"`
-	}
-	futures_buy_market := func(args futures_buy_market_args) (interface{}, error) {
-		rsp, err := quant.FuturesBuyMarket(args.Symbol, args.Quantity)
-		resultBytes, err := json.Marshal(rsp)
-		return map[string]interface{}{"result": string(resultBytes)}, err
+	// 交易循环只需要下单工具和记忆工具，行情数据已经在提示词中给出
+	// save_memory 保存的记忆会自动归档到长期记忆，recall_memories 在 setupMemories 中注册
+	packs.RegisterQuantTools(nil, packs.WithTrading(), packs.WithTools("futures_buy_market", "futures_sell_market", "futures_close_position"))
+	packs.RegisterStateTools(nil, packs.WithPackState(agentState()), packs.WithMemory("memory", TimeSlice), packs.WithTools("save_memory"))
+
+	// 会动用资金的工具加上数量和频率限制，平仓没有数量参数，只限制频率
+	trade := []mcp.PolicyOption{mcp.MaxValue("quantity", MaxQuantity), mcp.RateLimit(MaxTrades, TimeSlice)}
+	closePosition := []mcp.PolicyOption{mcp.RateLimit(MaxTrades, TimeSlice)}
+	if TradeApproval {
+		trade = append(trade, mcp.NeedApproval())
+		closePosition = append(closePosition, mcp.NeedApproval())
+		mcp.SetApprover(tradeApprover())
 	}
-	mcp.RegisterTool("futures_buy_market", futures_buy_market, futures_buy_market_args{})
+	mcp.SetPolicy("futures_buy_market", trade...)
+	mcp.SetPolicy("futures_sell_market", trade...)
+	mcp.SetPolicy("futures_close_position", closePosition...)
 
-	type futures_sell_market_args struct {
-		Symbol   string  `json:"symbol"`
-		Quantity float64 `json:"quantity"`
+	// 记录所有工具调用，影子交易时只记录不下单
+	if db, err := jsondb.NewDatabase(AuditFile); err != nil {
+		log.Printf("failed to open audit log: %v\n", err)
+	} else {
+		mcp.Use(mcp.AuditLog(db))
 	}
-	futures_sell_market := func(args futures_sell_market_args) (interface{}, error) {
-		rsp, err := quant.FuturesSellMarket(args.Symbol, args.Quantity)
-		resultBytes, err := json.Marshal(rsp)
-		return map[string]interface{}{"result": string(resultBytes)}, err
+	if ShadowTrade {
+		mcp.SetDryRun(true, "futures_buy_market", "futures_sell_market", "futures_close_position")
 	}
-	mcp.RegisterTool("futures_sell_market", futures_sell_market, futures_sell_market_args{})
+}
 
-	type futures_close_position_args struct {
-		Symbol string `json:"symbol"`
+// tradeApprover 在终端确认交易
+// 以 stdio 方式提供 MCP 服务时标准输入输出承载 JSON-RPC，改为在 /dev/tty 上确认；
+// 没有终端时返回 nil，需要审批的调用一律被拒绝
+func tradeApprover() mcp.Approver {
+	if MCPServe != "stdio" {
+		return mcp.ConsoleApprover(os.Stdin, os.Stdout, os.Getenv("USER"))
 	}
-	futures_close_position := func(args futures_close_position_args) (interface{}, error) {
-		rsp, err := quant.FuturesClosePosition(args.Symbol)
-		resultBytes, err := json.Marshal(rsp)
-		return map[string]interface{}{"result": string(resultBytes)}, err
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		log.Printf("no terminal for trade approval, trades will be denied: %v\n", err)
+		return nil
 	}
-	mcp.RegisterTool("futures_close_position", futures_close_position, futures_close_position_args{})
+	return mcp.ConsoleApprover(tty, tty, os.Getenv("USER"))
+}
+
+// agentState 返回模型通过 save_memory 等工具可以读写的状态命名空间
+func agentState() *state.StateManager {
+	return state.GetInstance().Namespace(packs.DefaultStateNamespace)
+}
 
-	type save_memory_args struct {
-		Memory string `json:"memory"`
+// ServeMCP 通过 MCP 协议暴露交易工具和状态，供外部 MCP 客户端调用
+// HTTP 默认只监听本机；设置环境变量 MCP_TOKEN 后要求 bearer token，并允许监听其他地址
+// ctx 取消时停止服务并返回 nil
+func ServeMCP(ctx context.Context, addr string) error {
+	opts := []mcp.ServerOption{mcp.WithServerInfo("cage-quant", "1.0.0"), mcp.WithStateResources(agentState())}
+	if token := os.Getenv("MCP_TOKEN"); token != "" {
+		opts = append(opts, mcp.WithBearerToken(token))
 	}
-	save_memory := func(args save_memory_args) (interface{}, error) {
-		state.GetInstance().Set("memory", args.Memory, state.WithTTL(TimeSlice))
-		return map[string]interface{}{"result": args.Memory}, nil
+	server := mcp.NewServer(nil, opts...)
+	if addr == "stdio" {
+		if err := server.ServeStdio(ctx, os.Stdin, os.Stdout); err != context.Canceled {
+			return err
+		}
+		return nil
 	}
-	mcp.RegisterTool("save_memory", save_memory, save_memory_args{})
+	log.Printf("MCP server listening on %s\n", addr)
+	return server.ListenAndServeContext(ctx, addr)
 }
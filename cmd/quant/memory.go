@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp/memory"
+	"github.com/Cai-ki/cage/llm/mcp/packs"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+// memories 长期记忆，由 setupMemories 创建
+var memories *memory.Store
+
+// setupMemories 创建长期记忆、注册 recall_memories 工具并开始归档 save_memory 保存的记忆
+// 记忆带有 embedding 向量，单独保存在 MemoryFile 中并按间隔写回，避免每次修改都重写整个文件
+// 返回的函数停止归档和后台合并，并做最后一次保存
+func setupMemories() func() {
+	sm := state.NewStateManager()
+	if err := sm.Persist(state.NewFileStore(MemoryFile), state.WithFlushInterval(MemoryFlushInterval)); err != nil {
+		log.Printf("failed to restore memories: %v\n", err)
+	}
+	memories = memory.NewStore(memory.WithState(sm), memory.WithConsolidation(MemoryConsolidateInterval, MemoryConsolidateAge))
+	packs.RegisterMemoryTools(nil, packs.WithMemoryStore(memories), packs.WithTools("recall_memories"))
+	stopArchive := archiveMemories(agentState())
+
+	return func() {
+		stopArchive()
+		memories.Close()
+		if err := sm.Close(); err != nil {
+			log.Printf("failed to save memories: %v\n", err)
+		}
+	}
+}
+
+// archiveMemories 将每次 save_memory 保存的短期记忆归档到长期记忆中
+// 返回的函数停止归档，并等待已经排队的记忆归档完成
+func archiveMemories(sm *state.StateManager) func() {
+	w := sm.Watch("memory")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range w.C {
+			text, ok := ev.New.(string)
+			if ev.Type != state.EventSet || !ok || text == "" {
+				continue
+			}
+			if _, err := memories.Add(text, memory.WithTags(Symbol)); err != nil {
+				log.Printf("failed to archive memory: %v\n", err)
+			}
+		}
+	}()
+	return func() {
+		w.Stop()
+		<-done
+	}
+}
+
+// formatRecalledMemories 返回与 query 最相关的长期记忆，失败或没有记忆时返回空字符串
+func formatRecalledMemories(query string) string {
+	if memories == nil {
+		return ""
+	}
+	results, err := memories.Recall(query, RecallMemories)
+	if err != nil {
+		log.Printf("failed to recall memories: %v\n", err)
+		return ""
+	}
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "- [%s] %s\n", r.CreatedAt.In(loc).Format("2006-01-02 15:04"), r.Content)
+	}
+	return b.String()
+}
@@ -8,7 +8,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Cai-ki/cage/llm/mcp/state"
 	"github.com/Cai-ki/cage/quant"
 	"github.com/Cai-ki/cage/sugar"
 )
@@ -144,7 +143,7 @@ func RecordTrade(prompt, decision, toolcalls string, add bool) error {
 	newRecord.Decision = decision
 	newRecord.ToolCalls = toolcalls
 
-	memory, ok := state.GetInstance().Get("memory")
+	memory, ok := agentState().Get("memory")
 	if ok {
 		newRecord.Memory = memory.(string)
 	} else {
@@ -232,12 +231,16 @@ func formatPerformanceSummary() string {
 		return "Performance data unavailable"
 	}
 
-	return fmt.Sprintf(
+	summary := fmt.Sprintf(
 		"- 决策时间: %s\n"+
 			"- 分析记忆: \n```\n%s\n```",
 		record.Date,
 		record.Memory,
 	)
+	if recalled := formatRecalledMemories(record.Memory); recalled != "" {
+		summary += "\n- 相关的长期记忆: \n" + recalled
+	}
+	return summary
 }
 
 func getTime() string {
@@ -11,6 +11,7 @@ import (
 	"github.com/Cai-ki/cage/llm/mcp"
 	"github.com/Cai-ki/cage/quant"
 	"github.com/adshao/go-binance/v2/futures"
+	"github.com/openai/openai-go"
 )
 
 func RunTradingStep(symbol string) error {
@@ -20,7 +21,11 @@ func RunTradingStep(symbol string) error {
 	prompt := BuildPrompt(symbol)
 
 	log.Println(prompt)
-	rsp, err := llm.CompletionByParams(llm.SystemMessage(prompt), llm.ToolsByJson(mcpString))
+	tools, err := mcp.GetToolsDefinition()
+	if err != nil {
+		return err
+	}
+	rsp, err := llm.CompletionByParams(llm.SystemMessage(prompt), llm.ToolFunc(func() []openai.ChatCompletionToolParam { return tools }))
 	if err != nil {
 		return err
 	}
@@ -2,11 +2,31 @@ package helper_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/Cai-ki/cage/helper"
+	"github.com/Cai-ki/cage/llm"
 )
 
+// 使用脚本化的假客户端离线测试，无需 API Key
+func TestJsonToSqlOffline(t *testing.T) {
+	fake := llm.NewFake(llm.ReplyText("CREATE TABLE data (symbol TEXT NOT NULL);"))
+	llm.SetDefaultClient(fake.Client())
+	defer llm.SetDefaultClient(nil)
+
+	sql, err := helper.JsonToSql(`{"symbol": "BTCUSDT"}`)
+	if err != nil {
+		t.Fatalf("JsonToSql error: %v", err)
+	}
+	if !strings.HasPrefix(sql, "CREATE TABLE data") {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+	if body := string(fake.Requests()[0].Body); !strings.Contains(body, "BTCUSDT") {
+		t.Errorf("Prompt should contain the input JSON: %s", body)
+	}
+}
+
 // 测试 JSON → SQL
 func TestJsonToSql(t *testing.T) {
 	jsonStr := `{
@@ -52,21 +52,42 @@ func NewDatabase(filePath string, opts ...Option) (*Database, error) {
 
 // Add 添加新记录（自动持久化）
 func (db *Database) Add(record interface{}) error {
-	// 将用户传入的结构体序列化为 JSON 字节数组
-	data, err := json.Marshal(record)
-	if err != nil {
-		return err
-	}
+	return db.AddMany(record)
+}
 
-	// 创建新的记录，使用当前时间作为时间戳
-	newRec := &Record{
-		Timestamp: time.Now(), // 自动获取当前时间，不依赖用户数据中的时间字段
-		RawData:   data,       // 保存用户数据的原始 JSON
+// AddMany 批量添加记录，开启自动保存时只持久化一次
+// 任意一条记录序列化失败时不会添加任何记录
+func (db *Database) AddMany(records ...interface{}) error {
+	// 先将所有记录序列化为 JSON，避免持锁期间出错导致只写入一部分
+	newRecs := make([]*Record, len(records))
+	for i, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		// 使用当前时间作为时间戳，不依赖用户数据中的时间字段
+		newRecs[i] = &Record{Timestamp: time.Now(), RawData: data}
+	}
+	if len(newRecs) == 0 {
+		return nil
 	}
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	for _, newRec := range newRecs {
+		db.insertUnsafe(newRec)
+	}
+
+	// 如果启用自动保存，则立即持久化到文件
+	if db.autoSave {
+		return db.saveUnsafe()
+	}
+	return nil
+}
+
+// insertUnsafe 按时间戳插入记录，调用方必须持有写锁
+func (db *Database) insertUnsafe(newRec *Record) {
 	// 二分查找插入位置，保持按时间戳升序排列
 	// 找到第一个时间戳大于 newRec.Timestamp 的位置
 	idx := sort.Search(len(db.records), func(i int) bool {
@@ -77,12 +98,6 @@ func (db *Database) Add(record interface{}) error {
 	db.records = append(db.records, nil)       // 扩容切片
 	copy(db.records[idx+1:], db.records[idx:]) // 向后移动元素
 	db.records[idx] = newRec                   // 插入新记录
-
-	// 如果启用自动保存，则立即持久化到文件
-	if db.autoSave {
-		return db.saveUnsafe()
-	}
-	return nil
 }
 
 // GetLatest 获取最近 N 条记录
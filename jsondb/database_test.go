@@ -69,6 +69,34 @@ func TestAddAndGetLatest(t *testing.T) {
 	}
 }
 
+func TestAddMany(t *testing.T) {
+	db, err := jsondb.NewDatabase("test_add_many.db")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer os.Remove("test_add_many.db")
+
+	if err := db.AddMany(TestRecord{ID: 1}, TestRecord{ID: 2}, TestRecord{ID: 3}); err != nil {
+		t.Fatalf("Failed to add records: %v", err)
+	}
+	if err := db.AddMany(TestRecord{ID: 4}, make(chan int)); err == nil {
+		t.Error("Expected marshal error")
+	}
+
+	// 重新加载，确认批量写入已持久化，且失败的批次没有写入
+	reloaded, err := jsondb.NewDatabase("test_add_many.db")
+	if err != nil {
+		t.Fatalf("Failed to reload database: %v", err)
+	}
+	var results []TestRecord
+	if err := reloaded.GetLatest(10, &results); err != nil {
+		t.Fatalf("Failed to get records: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != 1 || results[2].ID != 3 {
+		t.Errorf("Expected records 1-3 in order, got %+v", results)
+	}
+}
+
 func TestGetByTimeRange(t *testing.T) {
 	db, err := jsondb.NewDatabase("test_timerange.db")
 	if err != nil {
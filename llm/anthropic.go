@@ -0,0 +1,218 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	anthropicBaseURL   = "https://api.anthropic.com"
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096
+)
+
+// AnthropicProvider talks to the Anthropic Messages API.
+type AnthropicProvider struct {
+	BaseURL    string
+	APIKey     string
+	Version    string       // anthropic-version header
+	MaxTokens  int          // used when the request sets no limit; the API requires one
+	HTTPClient *http.Client // nil means http.DefaultClient
+}
+
+// NewAnthropicProvider creates an adapter; an empty baseURL uses the public API.
+func NewAnthropicProvider(baseURL, apiKey string) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = anthropicBaseURL
+	}
+	return &AnthropicProvider{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		APIKey:    apiKey,
+		Version:   anthropicVersion,
+		MaxTokens: anthropicMaxTokens,
+	}
+}
+
+type anthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   string           `json:"content,omitempty"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"` // base64 or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]any     `json:"tool_choice,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []anthropicBlock `json:"content"`
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, params openai.ChatCompletionNewParams) (openai.ChatCompletionMessage, error) {
+	req, err := parseChatRequest(params)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+
+	areq := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     max(req.MaxTokens, req.MaxCompletionTokens),
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.stops(),
+	}
+	if areq.MaxTokens == 0 {
+		areq.MaxTokens = p.MaxTokens
+	}
+	for _, t := range req.Tools {
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		areq.Tools = append(areq.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	areq.ToolChoice = anthropicToolChoice(req)
+
+	var system []string
+	for _, m := range req.Messages {
+		var role string
+		var blocks []anthropicBlock
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, m.text())
+			continue
+		case "tool":
+			role = "user"
+			blocks = []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.text()}}
+		case "assistant":
+			role = "assistant"
+			if text := m.text(); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+		default:
+			role = "user"
+			for _, part := range m.parts() {
+				switch part.Type {
+				case "text":
+					blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+				case "image_url":
+					blocks = append(blocks, anthropicBlock{Type: "image", Source: anthropicImage(part.ImageURL.URL)})
+				}
+			}
+		}
+
+		// The API requires alternating roles, so consecutive turns of one
+		// role (e.g. several tool results) are merged.
+		if n := len(areq.Messages); n > 0 && areq.Messages[n-1].Role == role {
+			areq.Messages[n-1].Content = append(areq.Messages[n-1].Content, blocks...)
+		} else {
+			areq.Messages = append(areq.Messages, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	areq.System = strings.Join(system, "\n\n")
+
+	header := http.Header{}
+	header.Set("x-api-key", p.APIKey)
+	header.Set("anthropic-version", p.Version)
+
+	var resp anthropicResponse
+	if err := postJSON(ctx, p.HTTPClient, p.BaseURL+"/v1/messages", header, areq, &resp); err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+
+	var text strings.Builder
+	var calls []ToolCall
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			calls = append(calls, ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	return assistantMessage(text.String(), calls)
+}
+
+// anthropicToolChoice maps tool_choice and parallel_tool_calls; "required"
+// is called "any" there.
+func anthropicToolChoice(req *chatRequest) map[string]any {
+	mode, name := req.toolChoice()
+	choice := map[string]any{}
+	switch mode {
+	case "auto", "none":
+		choice["type"] = mode
+	case "required":
+		choice["type"] = "any"
+	case "function":
+		choice["type"] = "tool"
+		choice["name"] = name
+	}
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls && mode != "none" {
+		if choice["type"] == nil {
+			choice["type"] = "auto"
+		}
+		choice["disable_parallel_tool_use"] = true
+	}
+	if len(choice) == 0 {
+		return nil
+	}
+	return choice
+}
+
+func anthropicImage(url string) *anthropicSource {
+	if mediaType, data, ok := splitDataURL(url); ok {
+		return &anthropicSource{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	return &anthropicSource{Type: "url", URL: url}
+}
+
+// Embed is not offered by the Anthropic API.
+func (p *AnthropicProvider) Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error) {
+	return nil, ErrNotSupported
+}
@@ -1 +1,226 @@
 package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"path/filepath"
+
+	"github.com/openai/openai-go"
+)
+
+// Transcript is the result of a transcription. Language, Duration, Segments
+// and Words are only filled when timestamps were requested.
+type Transcript struct {
+	Text     string              `json:"text"`
+	Language string              `json:"language,omitempty"`
+	Duration float64             `json:"duration,omitempty"` // seconds
+	Segments []TranscriptSegment `json:"segments,omitempty"`
+	Words    []TranscriptWord    `json:"words,omitempty"`
+}
+
+// TranscriptSegment is a span of recognized speech, in seconds from the start.
+type TranscriptSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// TranscriptWord is a single recognized word, in seconds from the start.
+type TranscriptWord struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Word  string  `json:"word"`
+}
+
+type transcribeOptions struct {
+	model       string
+	prompt      string
+	language    string
+	filename    string
+	granularity []string
+}
+
+// TranscribeOption configures a transcription request.
+type TranscribeOption func(*transcribeOptions)
+
+// WithTranscribePrompt guides the model with context or spelling of uncommon words.
+func WithTranscribePrompt(prompt string) TranscribeOption {
+	return func(o *transcribeOptions) {
+		o.prompt = prompt
+	}
+}
+
+// WithLanguage sets the ISO-639-1 language of the audio (e.g. "zh", "en").
+func WithLanguage(language string) TranscribeOption {
+	return func(o *transcribeOptions) {
+		o.language = language
+	}
+}
+
+// WithTimestamps requests segment and/or word timestamps ("segment", "word").
+// With no arguments, segment timestamps are requested.
+func WithTimestamps(granularities ...string) TranscribeOption {
+	return func(o *transcribeOptions) {
+		if len(granularities) == 0 {
+			granularities = []string{"segment"}
+		}
+		o.granularity = granularities
+	}
+}
+
+// WithAudioFilename names the upload; the extension tells the server the
+// audio format. Defaults to "audio.wav", matching media.RecordAudio.
+func WithAudioFilename(name string) TranscribeOption {
+	return func(o *transcribeOptions) {
+		o.filename = name
+	}
+}
+
+// WithTranscribeModel overrides Config.AudioModel for one request.
+func WithTranscribeModel(model string) TranscribeOption {
+	return func(o *transcribeOptions) {
+		o.model = model
+	}
+}
+
+// Transcribe converts speech to text.
+func (c *LLMClient) Transcribe(audio io.Reader) (string, error) {
+	t, err := c.TranscribeWithOptions(audio)
+	if err != nil {
+		return "", err
+	}
+	return t.Text, nil
+}
+
+// TranscribeWithPrompt converts speech to text, guided by a prompt.
+func (c *LLMClient) TranscribeWithPrompt(audio io.Reader, prompt string) (string, error) {
+	t, err := c.TranscribeWithOptions(audio, WithTranscribePrompt(prompt))
+	if err != nil {
+		return "", err
+	}
+	return t.Text, nil
+}
+
+// TranscribeWithOptions converts speech to text with language, prompt or timestamp options.
+func (c *LLMClient) TranscribeWithOptions(audio io.Reader, opts ...TranscribeOption) (*Transcript, error) {
+	o := &transcribeOptions{
+		model:    c.cfg.AudioModel,
+		filename: "audio.wav",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(o.filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	params := openai.AudioTranscriptionNewParams{
+		File:           openai.File(audio, o.filename, contentType),
+		Model:          o.model,
+		ResponseFormat: openai.AudioResponseFormatJSON,
+	}
+	if o.prompt != "" {
+		params.Prompt = openai.String(o.prompt)
+	}
+	if o.language != "" {
+		params.Language = openai.String(o.language)
+	}
+	if len(o.granularity) > 0 {
+		params.ResponseFormat = openai.AudioResponseFormatVerboseJSON
+		params.TimestampGranularities = o.granularity
+	}
+
+	resp, err := c.openai.Audio.Transcriptions.New(context.Background(), params)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transcript{Text: resp.Text}
+	if len(o.granularity) > 0 {
+		// verbose_json carries fields the SDK type does not expose
+		if err := json.Unmarshal([]byte(resp.RawJSON()), t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+type speechOptions struct {
+	model        string
+	voice        string
+	format       string
+	instructions string
+	speed        float64
+}
+
+// SpeechOption configures a speech synthesis request.
+type SpeechOption func(*speechOptions)
+
+// WithVoice overrides Config.SpeechVoice (e.g. "alloy", "nova").
+func WithVoice(voice string) SpeechOption {
+	return func(o *speechOptions) {
+		o.voice = voice
+	}
+}
+
+// WithSpeechModel overrides Config.SpeechModel for one request.
+func WithSpeechModel(model string) SpeechOption {
+	return func(o *speechOptions) {
+		o.model = model
+	}
+}
+
+// WithSpeechFormat sets the audio format: mp3 (default), opus, aac, flac, wav or pcm.
+func WithSpeechFormat(format string) SpeechOption {
+	return func(o *speechOptions) {
+		o.format = format
+	}
+}
+
+// WithSpeed sets the playback speed, from 0.25 to 4.0.
+func WithSpeed(speed float64) SpeechOption {
+	return func(o *speechOptions) {
+		o.speed = speed
+	}
+}
+
+// WithSpeechInstructions controls tone and style on models that support it.
+func WithSpeechInstructions(instructions string) SpeechOption {
+	return func(o *speechOptions) {
+		o.instructions = instructions
+	}
+}
+
+// Speech synthesizes text to audio. The caller must close the returned stream.
+func (c *LLMClient) Speech(text string, opts ...SpeechOption) (io.ReadCloser, error) {
+	o := &speechOptions{
+		model: c.cfg.SpeechModel,
+		voice: c.cfg.SpeechVoice,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	params := openai.AudioSpeechNewParams{
+		Input:          text,
+		Model:          o.model,
+		Voice:          openai.AudioSpeechNewParamsVoice(o.voice),
+		ResponseFormat: openai.AudioSpeechNewParamsResponseFormat(o.format),
+	}
+	if o.instructions != "" {
+		params.Instructions = openai.String(o.instructions)
+	}
+	if o.speed > 0 {
+		params.Speed = openai.Float(o.speed)
+	}
+
+	resp, err := c.openai.Audio.Speech.New(context.Background(), params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,90 @@
+package llm_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+func newAudioClient(t *testing.T) *llm.LLMClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/audio/transcriptions":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("Expected multipart body: %v", err)
+			}
+			if r.FormValue("model") != "whisper-1" || r.FormValue("language") != "zh" {
+				t.Errorf("Unexpected form: %v", r.MultipartForm.Value)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if r.FormValue("response_format") == "verbose_json" {
+				io.WriteString(w, `{"text":"买入","language":"chinese","duration":1.5,`+
+					`"segments":[{"id":0,"start":0,"end":1.5,"text":"买入"}]}`)
+				return
+			}
+			io.WriteString(w, `{"text":"买入"}`)
+		case "/audio/speech":
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"voice":"nova"`) {
+				t.Errorf("Expected voice override in request: %s", body)
+			}
+			w.Header().Set("Content-Type", "audio/mpeg")
+			io.WriteString(w, "MP3DATA")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := llm.NewClient(&llm.Config{
+		APIKey:      "test",
+		BaseURL:     srv.URL,
+		AudioModel:  "whisper-1",
+		SpeechModel: "tts-1",
+		SpeechVoice: "alloy",
+	})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return client
+}
+
+func TestTranscribeWithOptions(t *testing.T) {
+	client := newAudioClient(t)
+
+	text, err := client.TranscribeWithOptions(strings.NewReader("RIFF"), llm.WithLanguage("zh"))
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if text.Text != "买入" || len(text.Segments) != 0 {
+		t.Errorf("Unexpected transcript: %+v", text)
+	}
+
+	text, err = client.TranscribeWithOptions(strings.NewReader("RIFF"), llm.WithLanguage("zh"), llm.WithTimestamps())
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if len(text.Segments) != 1 || text.Segments[0].End != 1.5 {
+		t.Errorf("Expected one segment ending at 1.5s, got %+v", text.Segments)
+	}
+}
+
+func TestSpeech(t *testing.T) {
+	client := newAudioClient(t)
+
+	audio, err := client.Speech("hello", llm.WithVoice("nova"))
+	if err != nil {
+		t.Fatalf("Speech failed: %v", err)
+	}
+	defer audio.Close()
+
+	data, _ := io.ReadAll(audio)
+	if string(data) != "MP3DATA" {
+		t.Errorf("Unexpected audio body: %q", data)
+	}
+}
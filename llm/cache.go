@@ -0,0 +1,236 @@
+package llm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// ResponseCache stores chat replies keyed by ResponseKey. Values are the JSON
+// encoding of an openai.ChatCompletionMessage.
+type ResponseCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte) error
+}
+
+// ResponseKey hashes everything that determines a reply: the provider and
+// endpoint it is sent to, model, messages, tools and sampling parameters.
+func ResponseKey(provider, baseURL string, params openai.ChatCompletionNewParams) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	// NUL cannot appear in a provider name or URL, so fields cannot run together
+	h.Write([]byte(provider + "\x00" + baseURL + "\x00"))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WithResponseCache caches chat replies of this client.
+func WithResponseCache(cache ResponseCache) ClientOption {
+	return func(c *LLMClient) {
+		c.respCache = cache
+	}
+}
+
+// SetResponseCache enables caching of chat replies; nil disables it.
+func (c *LLMClient) SetResponseCache(cache ResponseCache) {
+	c.respCache = cache
+}
+
+// newResponseCache builds the cache named by cfg.Cache.
+func newResponseCache(cfg *Config) ResponseCache {
+	switch cfg.Cache {
+	case "memory":
+		return NewLRUResponseCache(cfg.CacheSize, cfg.CacheTTL)
+	case "disk":
+		return NewDiskResponseCache(cfg.CacheDir, cfg.CacheTTL)
+	}
+	return nil
+}
+
+// LRUResponseCache is an in-memory cache that evicts the least recently used
+// entry beyond its capacity.
+type LRUResponseCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUResponseCache creates a cache holding up to size replies (0 means
+// 1000); a zero ttl never expires entries.
+func NewLRUResponseCache(size int, ttl time.Duration) *LRUResponseCache {
+	if size <= 0 {
+		size = 1000
+	}
+	return &LRUResponseCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *LRUResponseCache) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (l *LRUResponseCache) Set(key string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := &lruEntry{key: key, value: value}
+	if l.ttl > 0 {
+		entry.expiresAt = time.Now().Add(l.ttl)
+	}
+	if elem, ok := l.entries[key]; ok {
+		elem.Value = entry
+		l.order.MoveToFront(elem)
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of cached replies.
+func (l *LRUResponseCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// DiskResponseCache stores one JSON file per reply, so the cache survives
+// restarts and can be shared between CI runs.
+type DiskResponseCache struct {
+	dir string
+	ttl time.Duration
+}
+
+type diskEntry struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// NewDiskResponseCache stores replies under dir; a zero ttl never expires entries.
+func NewDiskResponseCache(dir string, ttl time.Duration) *DiskResponseCache {
+	return &DiskResponseCache{dir: dir, ttl: ttl}
+}
+
+func (d *DiskResponseCache) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
+
+func (d *DiskResponseCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if d.ttl > 0 && time.Since(entry.CreatedAt) > d.ttl {
+		os.Remove(d.path(key))
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (d *DiskResponseCache) Set(key string, value []byte) error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(diskEntry{CreatedAt: time.Now(), Value: value})
+	if err != nil {
+		return err
+	}
+	// Write to a unique temp file then rename, so concurrent writers of the
+	// same key do not clobber each other and readers never see a partial file
+	tmp, err := os.CreateTemp(d.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// cachedChat serves params from the response cache, falling back to the provider.
+func (c *LLMClient) cachedChat(params openai.ChatCompletionNewParams, opts *callOptions) (openai.ChatCompletionMessage, error) {
+	if c.respCache == nil || opts.bypassCache || c.cfg.CacheBypass {
+		return c.chat(params)
+	}
+
+	key, err := ResponseKey(c.cfg.Provider, c.cfg.BaseURL, params)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if data, ok := c.respCache.Get(key); ok {
+		var msg openai.ChatCompletionMessage
+		if err := json.Unmarshal(data, &msg); err == nil {
+			return msg, nil
+		}
+	}
+
+	msg, err := c.chat(params)
+	if err != nil {
+		return msg, err
+	}
+	// The reply is already paid for; a cache failure must not lose it
+	data := []byte(msg.RawJSON())
+	if len(data) == 0 {
+		if data, err = json.Marshal(msg); err != nil {
+			log.Printf("llm: encode cached reply: %v", err)
+			return msg, nil
+		}
+	}
+	if err := c.respCache.Set(key, data); err != nil {
+		log.Printf("llm: cache reply: %v", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,131 @@
+package llm_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm"
+	"github.com/openai/openai-go"
+)
+
+func TestResponseCache(t *testing.T) {
+	fake := llm.NewFake(llm.ReplyText("first"), llm.ReplyText("second"))
+	client := fake.Client()
+	client.SetResponseCache(llm.NewLRUResponseCache(10, 0))
+
+	for i := 0; i < 2; i++ {
+		msg, err := client.CompletionByParams(llm.UserMessage("hi"))
+		if err != nil || msg.Content != "first" {
+			t.Fatalf("Expected cached 'first', got %q (%v)", msg.Content, err)
+		}
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Fatalf("Expected 1 request, got %d", n)
+	}
+
+	msg, err := client.CompletionByParams(llm.UserMessage("hi"), llm.BypassCache())
+	if err != nil || msg.Content != "second" {
+		t.Fatalf("Expected 'second' with bypass, got %q (%v)", msg.Content, err)
+	}
+	if n := len(fake.Requests()); n != 2 {
+		t.Errorf("Expected bypass to reach the provider, got %d requests", n)
+	}
+}
+
+// failingCache 写入总是失败
+type failingCache struct{}
+
+func (failingCache) Get(string) ([]byte, bool) { return nil, false }
+func (failingCache) Set(string, []byte) error  { return errors.New("disk full") }
+
+func TestResponseCacheSetError(t *testing.T) {
+	fake := llm.NewFake(llm.ReplyText("paid"))
+	client := fake.Client()
+	client.SetResponseCache(failingCache{})
+	msg, err := client.CompletionByParams(llm.UserMessage("hi"))
+	if err != nil || msg.Content != "paid" {
+		t.Errorf("Expected reply despite cache failure, got %q (%v)", msg.Content, err)
+	}
+}
+
+func TestResponseKey(t *testing.T) {
+	params := openai.ChatCompletionNewParams{
+		Model:    "test",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	}
+	a, _ := llm.ResponseKey("openai", "https://api.openai.com/v1", params)
+	b, _ := llm.ResponseKey("openai", "http://localhost:11434/v1", params)
+	c, _ := llm.ResponseKey("anthropic", "https://api.openai.com/v1", params)
+	if a == b || a == c {
+		t.Errorf("Expected provider and base URL to be part of the key")
+	}
+	if again, _ := llm.ResponseKey("openai", "https://api.openai.com/v1", params); again != a {
+		t.Errorf("Expected stable key, got %s and %s", a, again)
+	}
+}
+
+func TestLRUResponseCache(t *testing.T) {
+	cache := llm.NewLRUResponseCache(2, 0)
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Get("a") // b 成为最久未使用
+	cache.Set("c", []byte("3"))
+	if _, ok := cache.Get("b"); ok || cache.Len() != 2 {
+		t.Errorf("Expected b to be evicted, len=%d", cache.Len())
+	}
+	if v, ok := cache.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("Expected a to survive, got %q", v)
+	}
+
+	ttl := llm.NewLRUResponseCache(0, time.Millisecond)
+	ttl.Set("k", []byte("v"))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := ttl.Get("k"); ok {
+		t.Error("Expected entry to expire")
+	}
+}
+
+func TestDiskResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	fake := llm.NewFake(llm.ReplyText("cached"))
+	client := fake.Client()
+	client.SetResponseCache(llm.NewDiskResponseCache(dir, time.Hour))
+	if _, err := client.CompletionByParams(llm.UserMessage("hi")); err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+
+	// 新客户端共享同一目录，无需再请求
+	other := llm.NewFake()
+	client = other.Client()
+	client.SetResponseCache(llm.NewDiskResponseCache(dir, time.Hour))
+	msg, err := client.CompletionByParams(llm.UserMessage("hi"))
+	if err != nil || msg.Content != "cached" || len(other.Requests()) != 0 {
+		t.Fatalf("Expected reply from disk, got %q (%v)", msg.Content, err)
+	}
+
+	// 并发写入同一个键不会互相覆盖临时文件
+	disk := llm.NewDiskResponseCache(dir, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := disk.Set("same", []byte(`"v"`)); err != nil {
+				t.Errorf("Concurrent Set failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, ok := disk.Get("same"); !ok || string(v) != `"v"` {
+		t.Errorf("Expected value after concurrent writes, got %q", v)
+	}
+
+	expired := llm.NewDiskResponseCache(dir, time.Nanosecond)
+	expired.Set("k", []byte(`{}`))
+	time.Sleep(time.Millisecond)
+	if _, ok := expired.Get("k"); ok {
+		t.Error("Expected disk entry to expire")
+	}
+}
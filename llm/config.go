@@ -2,30 +2,69 @@ package llm
 
 import (
 	"os"
+	"time"
 
 	"github.com/Cai-ki/cage/sugar"
 )
 
 type Config struct {
-	APIKey      string
-	BaseURL     string // 支持兼容 API（如 Ollama）
-	Model       string // 默认文本模型
-	VisionModel string // 默认视觉模型
-	EmbedModel  string // 默认 embedding 模型
-	EmbedDim    int
-	Temperature float64
-	TopP        float64
+	APIKey         string
+	BaseURL        string // 支持兼容 API（如 Ollama）
+	Provider       string // 接口类型：openai（默认，含兼容 API）、anthropic 或 ollama
+	Model          string // 默认文本模型
+	VisionModel    string // 默认视觉模型
+	VisionDetail   string // 默认图片细节级别：low、high 或 auto
+	VisionMaxSize  int    // 图片最长边上限（像素），超出时自动缩放，0 表示不限制
+	VisionFormat   string // 图片编码格式：png 或 jpeg
+	EmbedModel     string // 默认 embedding 模型
+	EmbedDim       int
+	EmbedBatchSize int    // 单次 embedding 请求的最大文本数
+	AudioModel     string // 默认语音识别模型（如 whisper-1）
+	SpeechModel    string // 默认语音合成模型（如 tts-1）
+	SpeechVoice    string // 默认语音合成音色
+	Temperature    float64
+	TopP           float64
+	ContextWindow  int           // 模型上下文窗口（token 数），0 表示使用默认值
+	RecordMode     string        // 录制回放模式：record、replay 或 auto，空表示直连
+	FixtureDir     string        // 录制文件目录
+	Cache          string        // 响应缓存：memory、disk，空表示不缓存
+	CacheDir       string        // 磁盘缓存目录
+	CacheSize      int           // 内存缓存条目上限
+	CacheTTL       time.Duration // 缓存有效期，0 表示永不过期
+	CacheBypass    bool          // 跳过缓存（仍可通过 BypassCache 按次跳过）
 }
 
 func LoadConfig() (*Config, error) {
 	return &Config{
-		APIKey:      os.Getenv("LLM_API_KEY"),
-		BaseURL:     os.Getenv("LLM_BASE_URL"),
-		Model:       os.Getenv("LLM_MODEL"),
-		VisionModel: os.Getenv("LLM_VISION_MODEL"),
-		EmbedModel:  os.Getenv("LLM_EMBED_MODEL"),
-		EmbedDim:    sugar.StrToTWithDefault(os.Getenv("LLM_EMBED_DIM"), 0),
-		Temperature: sugar.StrToTWithDefault(os.Getenv("LLM_TEMPERATURE"), 0.0),
-		TopP:        sugar.StrToTWithDefault(os.Getenv("LLM_TOPP"), 0.8),
+		APIKey:         os.Getenv("LLM_API_KEY"),
+		BaseURL:        os.Getenv("LLM_BASE_URL"),
+		Provider:       os.Getenv("LLM_PROVIDER"),
+		Model:          os.Getenv("LLM_MODEL"),
+		VisionModel:    os.Getenv("LLM_VISION_MODEL"),
+		VisionDetail:   sugar.Coalsece(os.Getenv("LLM_VISION_DETAIL"), "auto"),
+		VisionMaxSize:  sugar.StrToTWithDefault(os.Getenv("LLM_VISION_MAX_SIZE"), 0),
+		VisionFormat:   sugar.Coalsece(os.Getenv("LLM_VISION_FORMAT"), "png"),
+		EmbedModel:     os.Getenv("LLM_EMBED_MODEL"),
+		EmbedDim:       sugar.StrToTWithDefault(os.Getenv("LLM_EMBED_DIM"), 0),
+		EmbedBatchSize: sugar.StrToTWithDefault(os.Getenv("LLM_EMBED_BATCH_SIZE"), 64),
+		AudioModel:     sugar.Coalsece(os.Getenv("LLM_AUDIO_MODEL"), "whisper-1"),
+		SpeechModel:    sugar.Coalsece(os.Getenv("LLM_SPEECH_MODEL"), "tts-1"),
+		SpeechVoice:    sugar.Coalsece(os.Getenv("LLM_SPEECH_VOICE"), "alloy"),
+		Temperature:    sugar.StrToTWithDefault(os.Getenv("LLM_TEMPERATURE"), 0.0),
+		TopP:           sugar.StrToTWithDefault(os.Getenv("LLM_TOPP"), 0.8),
+		ContextWindow:  sugar.StrToTWithDefault(os.Getenv("LLM_CONTEXT_WINDOW"), 0),
+		RecordMode:     os.Getenv("LLM_RECORD_MODE"),
+		FixtureDir:     sugar.Coalsece(os.Getenv("LLM_FIXTURE_DIR"), "testdata/llm"),
+		Cache:          os.Getenv("LLM_CACHE"),
+		CacheDir:       sugar.Coalsece(os.Getenv("LLM_CACHE_DIR"), ".cache/llm"),
+		CacheSize:      sugar.StrToTWithDefault(os.Getenv("LLM_CACHE_SIZE"), 1000),
+		CacheTTL:       parseDuration(os.Getenv("LLM_CACHE_TTL")),
+		CacheBypass:    sugar.StrToTWithDefault(os.Getenv("LLM_CACHE_BYPASS"), false),
 	}, nil
 }
+
+// parseDuration parses values like "10m"; invalid or empty values yield 0.
+func parseDuration(s string) time.Duration {
+	d, _ := time.ParseDuration(s)
+	return d
+}
@@ -0,0 +1,489 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Cai-ki/cage/jsondb"
+	"github.com/openai/openai-go"
+)
+
+const (
+	defaultContextWindow = 8192
+	defaultReserveTokens = 1024
+	messageOverhead      = 4 // role and separators per message
+)
+
+// Message is a single turn of a Conversation in a serializable form.
+type Message struct {
+	Role       string     `json:"role"` // system, user, assistant or tool
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Time       time.Time  `json:"time"`
+}
+
+// ToolCall is a function call requested by the assistant.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// param converts the message into the openai request shape.
+func (m Message) param() openai.ChatCompletionMessageParamUnion {
+	switch m.Role {
+	case "system":
+		return openai.SystemMessage(m.Content)
+	case "tool":
+		return openai.ToolMessage(m.Content, m.ToolCallID)
+	case "assistant":
+		asst := openai.ChatCompletionAssistantMessageParam{}
+		if m.Content != "" {
+			asst.Content.OfString = openai.String(m.Content)
+		}
+		for _, tc := range m.ToolCalls {
+			asst.ToolCalls = append(asst.ToolCalls, openai.ChatCompletionMessageToolCallParam{
+				ID: tc.ID,
+				Function: openai.ChatCompletionMessageToolCallFunctionParam{
+					Name:      tc.Name,
+					Arguments: tc.Arguments,
+				},
+			})
+		}
+		return openai.ChatCompletionMessageParamUnion{OfAssistant: &asst}
+	default:
+		return openai.UserMessage(m.Content)
+	}
+}
+
+// tokens estimates the prompt size of the message.
+func (m Message) tokens(count func(string) int) int {
+	n := messageOverhead + count(m.Content)
+	for _, tc := range m.ToolCalls {
+		n += count(tc.Name) + count(tc.Arguments)
+	}
+	return n
+}
+
+// EstimateTokens gives a rough token count for text without a tokenizer:
+// about four ASCII characters per token, and one token per non-ASCII rune
+// (CJK text tokenizes close to one token per character).
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// Conversation holds the system prompt and ordered history of a chat session.
+// When the history approaches the context window, the oldest turns are dropped
+// or, with WithSummarize, folded into a running summary.
+type Conversation struct {
+	mu            sync.Mutex
+	id            string
+	system        string
+	summary       string
+	messages      []Message
+	client        *LLMClient
+	contextWindow int
+	reserve       int
+	summarize     bool
+	countTokens   func(string) int
+}
+
+// ConversationOption configures a Conversation.
+type ConversationOption func(*Conversation)
+
+// WithConversationID sets the identifier used when saving to and restoring from jsondb.
+func WithConversationID(id string) ConversationOption {
+	return func(c *Conversation) {
+		c.id = id
+	}
+}
+
+// WithConversationClient sends requests through client instead of the default client.
+func WithConversationClient(client *LLMClient) ConversationOption {
+	return func(c *Conversation) {
+		c.client = client
+	}
+}
+
+// WithContextWindow sets the model context window in tokens.
+func WithContextWindow(tokens int) ConversationOption {
+	return func(c *Conversation) {
+		c.contextWindow = tokens
+	}
+}
+
+// WithReserveTokens keeps room in the context window for the model's reply.
+func WithReserveTokens(tokens int) ConversationOption {
+	return func(c *Conversation) {
+		c.reserve = tokens
+	}
+}
+
+// WithSummarize summarizes trimmed turns with the LLM instead of dropping them.
+func WithSummarize(enable bool) ConversationOption {
+	return func(c *Conversation) {
+		c.summarize = enable
+	}
+}
+
+// WithTokenCounter replaces EstimateTokens, e.g. with a real tokenizer.
+func WithTokenCounter(count func(string) int) ConversationOption {
+	return func(c *Conversation) {
+		c.countTokens = count
+	}
+}
+
+// NewConversation creates a conversation with the given system prompt.
+func NewConversation(system string, opts ...ConversationOption) *Conversation {
+	c := &Conversation{
+		system:      system,
+		reserve:     defaultReserveTokens,
+		countTokens: EstimateTokens,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ID returns the conversation identifier.
+func (c *Conversation) ID() string {
+	return c.id
+}
+
+// System returns the system prompt.
+func (c *Conversation) System() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.system
+}
+
+// SetSystem replaces the system prompt, e.g. with fresh market data each step.
+func (c *Conversation) SetSystem(system string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.system = system
+}
+
+// Summary returns the summary of turns that were trimmed from the history.
+func (c *Conversation) Summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary
+}
+
+// Messages returns a copy of the history.
+func (c *Conversation) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// AddUser appends a user message.
+func (c *Conversation) AddUser(content string) {
+	c.append(Message{Role: "user", Content: content})
+}
+
+// AddAssistant appends a model reply, including its tool calls.
+func (c *Conversation) AddAssistant(msg openai.ChatCompletionMessage) {
+	m := Message{Role: "assistant", Content: msg.Content}
+	for _, tc := range msg.ToolCalls {
+		m.ToolCalls = append(m.ToolCalls, ToolCall{
+			ID:        tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	c.append(m)
+}
+
+// AddToolResults appends the tool messages returned by mcp.ExecuteToolCalls.
+func (c *Conversation) AddToolResults(results []openai.ChatCompletionMessageParamUnion) {
+	for _, r := range results {
+		if r.OfTool == nil {
+			continue
+		}
+		content := r.OfTool.Content.OfString.Value
+		for _, part := range r.OfTool.Content.OfArrayOfContentParts {
+			content += part.Text
+		}
+		c.append(Message{Role: "tool", Content: content, ToolCallID: r.OfTool.ToolCallID})
+	}
+}
+
+func (c *Conversation) append(m Message) {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, m)
+}
+
+// Params returns the system prompt, summary and history as CompletionByParams arguments.
+func (c *Conversation) Params() []AllowedParam {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paramsUnsafe()
+}
+
+func (c *Conversation) paramsUnsafe() []AllowedParam {
+	params := []AllowedParam{}
+	if c.system != "" {
+		params = append(params, SystemMessage(c.system))
+	}
+	if c.summary != "" {
+		params = append(params, SystemMessage("Summary of the earlier conversation:\n"+c.summary))
+	}
+	for _, m := range c.messages {
+		p := m.param()
+		params = append(params, MessageFunc(func() openai.ChatCompletionMessageParamUnion { return p }))
+	}
+	return params
+}
+
+// Tokens returns the estimated prompt size of the whole conversation.
+func (c *Conversation) Tokens() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokensUnsafe()
+}
+
+func (c *Conversation) tokensUnsafe() int {
+	n := 0
+	if c.system != "" {
+		n += messageOverhead + c.countTokens(c.system)
+	}
+	if c.summary != "" {
+		n += messageOverhead + c.countTokens(c.summary)
+	}
+	for _, m := range c.messages {
+		n += m.tokens(c.countTokens)
+	}
+	return n
+}
+
+// Send appends prompt as a user message (unless empty), trims the history to
+// fit the context window and returns the model reply, which is appended too.
+// extra carries tools or other per-call arguments.
+func (c *Conversation) Send(prompt string, extra ...AllowedParam) (openai.ChatCompletionMessage, error) {
+	client, err := c.resolveClient()
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if prompt != "" {
+		c.AddUser(prompt)
+	}
+	if err := c.Trim(); err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+
+	msg, err := client.CompletionByParams(append(c.Params(), extra...)...)
+	if err != nil {
+		return msg, err
+	}
+	c.AddAssistant(msg)
+	return msg, nil
+}
+
+func (c *Conversation) resolveClient() (*LLMClient, error) {
+	return clientOrDefault(c.client)
+}
+
+// budget is the number of prompt tokens allowed before trimming.
+func (c *Conversation) budget() int {
+	window := c.contextWindow
+	if window <= 0 {
+		// Without a usable client fall back to the default window
+		if client, err := c.resolveClient(); err == nil {
+			window = client.cfg.ContextWindow
+		}
+	}
+	if window <= 0 {
+		window = defaultContextWindow
+	}
+	return window - c.reserve
+}
+
+// Trim removes the oldest turns until the conversation fits the context
+// window. A turn starts at a user message, so tool results are never
+// separated from the assistant call that requested them. The latest turn is
+// always kept.
+func (c *Conversation) Trim() error {
+	// Resolved outside the lock: it may load the default client
+	budget := c.budget()
+	for {
+		c.mu.Lock()
+		var dropped []Message
+		for c.tokensUnsafe() > budget {
+			cut := c.nextTurnUnsafe()
+			if cut <= 0 {
+				break
+			}
+			dropped = append(dropped, c.messages[:cut]...)
+			c.messages = append([]Message(nil), c.messages[cut:]...)
+		}
+		summarize := c.summarize && len(dropped) > 0
+		previous := c.summary
+		c.mu.Unlock()
+
+		if !summarize {
+			return nil
+		}
+
+		client, err := c.resolveClient()
+		if err == nil {
+			var summary string
+			summary, err = client.Completion(summaryPrompt(previous, dropped))
+			if err == nil {
+				// The longer summary may push the conversation over the
+				// budget again, so check once more.
+				c.mu.Lock()
+				c.summary = strings.TrimSpace(summary)
+				c.mu.Unlock()
+				continue
+			}
+		}
+
+		// Put the turns back so a failed summary loses nothing.
+		c.mu.Lock()
+		c.messages = append(dropped, c.messages...)
+		c.mu.Unlock()
+		return err
+	}
+}
+
+// nextTurnUnsafe returns the index of the second user message, i.e. the
+// length of the oldest turn, or 0 if only one turn remains.
+func (c *Conversation) nextTurnUnsafe() int {
+	for i := 1; i < len(c.messages); i++ {
+		if c.messages[i].Role == "user" {
+			return i
+		}
+	}
+	return 0
+}
+
+func summaryPrompt(previous string, dropped []Message) string {
+	var b strings.Builder
+	b.WriteString("Summarize the following conversation history in a few sentences. ")
+	b.WriteString("Keep decisions, facts and open questions; omit small talk.\n\n")
+	if previous != "" {
+		b.WriteString("Existing summary:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("New messages:\n")
+	for _, m := range dropped {
+		b.WriteString(m.Role)
+		b.WriteString(": ")
+		b.WriteString(m.Content)
+		for _, tc := range m.ToolCalls {
+			b.WriteString(" [call " + tc.Name + " " + tc.Arguments + "]")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// conversationType tags conversation snapshots so they can share a jsondb
+// file with other records.
+const conversationType = "llm.conversation"
+
+// conversationSnapshot is the persisted form of a Conversation.
+type conversationSnapshot struct {
+	Type     string    `json:"type"`
+	ID       string    `json:"id"`
+	System   string    `json:"system"`
+	Summary  string    `json:"summary,omitempty"`
+	Messages []Message `json:"messages"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// MarshalJSON encodes the prompt, summary and history.
+func (c *Conversation) MarshalJSON() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(conversationSnapshot{
+		Type:     conversationType,
+		ID:       c.id,
+		System:   c.system,
+		Summary:  c.summary,
+		Messages: c.messages,
+		SavedAt:  time.Now(),
+	})
+}
+
+// UnmarshalJSON restores the prompt, summary and history; options such as the
+// client or context window are left unchanged.
+func (c *Conversation) UnmarshalJSON(data []byte) error {
+	var snap conversationSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = snap.ID
+	c.system = snap.System
+	c.summary = snap.Summary
+	c.messages = snap.Messages
+	if c.countTokens == nil {
+		c.countTokens = EstimateTokens
+	}
+	return nil
+}
+
+// Save stores a snapshot of the conversation in db, replacing the one
+// previously saved under the same ID.
+func (c *Conversation) Save(db *jsondb.Database) error {
+	data, err := c.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	// Replace in place so a failed write never loses the previous snapshot
+	match := conversationRecord(c.ID())
+	if db.Exists(match) {
+		return db.UpdateByCondition(match, func(interface{}) interface{} { return json.RawMessage(data) })
+	}
+	return db.Add(json.RawMessage(data))
+}
+
+// RestoreConversation loads the snapshot saved under id.
+func RestoreConversation(db *jsondb.Database, id string, opts ...ConversationOption) (*Conversation, error) {
+	var snap json.RawMessage
+	if err := db.First(conversationRecord(id), &snap); err != nil {
+		return nil, err
+	}
+	if len(snap) == 0 {
+		return nil, ErrConversationNotFound
+	}
+
+	c := NewConversation("", opts...)
+	if err := c.UnmarshalJSON(snap); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// conversationRecord matches the records holding a snapshot of conversation id.
+func conversationRecord(id string) func(*jsondb.Record) bool {
+	return func(r *jsondb.Record) bool {
+		var head struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		return json.Unmarshal(r.RawData, &head) == nil && head.Type == conversationType && head.ID == id
+	}
+}
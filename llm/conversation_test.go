@@ -0,0 +1,202 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/jsondb"
+	"github.com/Cai-ki/cage/llm"
+	"github.com/openai/openai-go"
+)
+
+// newChatServer 启动一个兼容 OpenAI 的假服务，按顺序返回 replies，并记录每次请求体
+func newChatServer(t *testing.T, replies ...string) (*llm.LLMClient, *[]string) {
+	t.Helper()
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, string(body))
+		reply := ""
+		if len(replies) > 0 {
+			reply, replies = replies[0], replies[1:]
+		}
+		content, _ := json.Marshal(reply)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-test","object":"chat.completion","created":0,"model":"test",`+
+			`"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":`+string(content)+`}}]}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := llm.NewClient(&llm.Config{APIKey: "test", BaseURL: srv.URL, Model: "test"})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return client, &requests
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if n := llm.EstimateTokens("abcdefgh"); n != 2 {
+		t.Errorf("Expected 2 tokens for 8 ASCII chars, got %d", n)
+	}
+	if n := llm.EstimateTokens("你好"); n != 2 {
+		t.Errorf("Expected 2 tokens for 2 CJK chars, got %d", n)
+	}
+}
+
+func TestConversationSend(t *testing.T) {
+	client, requests := newChatServer(t, "first", "second")
+	conv := llm.NewConversation("you are a trader", llm.WithConversationClient(client))
+
+	if _, err := conv.Send("hello"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	msg, err := conv.Send("again")
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg.Content != "second" {
+		t.Errorf("Expected reply 'second', got '%s'", msg.Content)
+	}
+
+	if len(conv.Messages()) != 4 {
+		t.Fatalf("Expected 4 messages in history, got %d", len(conv.Messages()))
+	}
+	last := (*requests)[1]
+	for _, want := range []string{"you are a trader", "hello", "first", "again"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("Second request should contain %q: %s", want, last)
+		}
+	}
+}
+
+func TestConversationTrim(t *testing.T) {
+	conv := llm.NewConversation("sys", llm.WithContextWindow(60), llm.WithReserveTokens(0))
+	for i := 0; i < 5; i++ {
+		conv.AddUser(strings.Repeat("u", 40))
+		conv.AddAssistant(openai.ChatCompletionMessage{Content: strings.Repeat("a", 40)})
+	}
+
+	if err := conv.Trim(); err != nil {
+		t.Fatalf("Trim failed: %v", err)
+	}
+	if conv.Tokens() > 60 {
+		t.Errorf("Expected at most 60 tokens after trim, got %d", conv.Tokens())
+	}
+	msgs := conv.Messages()
+	if len(msgs) == 0 || msgs[0].Role != "user" {
+		t.Errorf("History should start at a user turn, got %+v", msgs)
+	}
+}
+
+func TestConversationSummarize(t *testing.T) {
+	client, _ := newChatServer(t, "earlier we discussed BTC")
+	conv := llm.NewConversation("sys",
+		llm.WithConversationClient(client),
+		llm.WithContextWindow(40),
+		llm.WithReserveTokens(0),
+		llm.WithSummarize(true),
+	)
+	conv.AddUser(strings.Repeat("old ", 30))
+	conv.AddAssistant(openai.ChatCompletionMessage{Content: "ok"})
+	conv.AddUser("new")
+
+	if err := conv.Trim(); err != nil {
+		t.Fatalf("Trim failed: %v", err)
+	}
+	if conv.Summary() != "earlier we discussed BTC" {
+		t.Errorf("Unexpected summary: %q", conv.Summary())
+	}
+	if len(conv.Messages()) != 1 {
+		t.Errorf("Expected only the latest turn to remain, got %d messages", len(conv.Messages()))
+	}
+}
+
+func TestConversationSummaryOverBudget(t *testing.T) {
+	fake := llm.NewFake(llm.ReplyText(strings.Repeat("s", 20)), llm.ReplyText("short"))
+	conv := llm.NewConversation("",
+		llm.WithConversationClient(fake.Client()),
+		llm.WithContextWindow(30),
+		llm.WithReserveTokens(0),
+		llm.WithSummarize(true),
+		llm.WithTokenCounter(func(s string) int { return len(s) }),
+	)
+	conv.AddUser(strings.Repeat("a", 10))
+	conv.AddAssistant(openai.ChatCompletionMessage{Content: "x"})
+	conv.AddUser(strings.Repeat("b", 5))
+	conv.AddAssistant(openai.ChatCompletionMessage{Content: "y"})
+	conv.AddUser(strings.Repeat("c", 5))
+
+	// 第一次摘要过长，需要再丢弃一轮并重新摘要
+	if err := conv.Trim(); err != nil {
+		t.Fatalf("Trim failed: %v", err)
+	}
+	if conv.Tokens() > 30 || conv.Summary() != "short" || len(conv.Messages()) != 1 || len(fake.Requests()) != 2 {
+		t.Errorf("Expected a second summary round, got %d tokens, summary %q, %d messages", conv.Tokens(), conv.Summary(), len(conv.Messages()))
+	}
+}
+
+func TestConversationSaveRestore(t *testing.T) {
+	db, err := jsondb.NewDatabase("test_conversation.db")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer os.Remove("test_conversation.db")
+
+	conv := llm.NewConversation("sys", llm.WithConversationID("session-1"))
+	conv.AddUser("remember BTC")
+	conv.AddAssistant(openai.ChatCompletionMessage{
+		ToolCalls: []openai.ChatCompletionMessageToolCall{{
+			ID:       "call_1",
+			Function: openai.ChatCompletionMessageToolCallFunction{Name: "save_memory", Arguments: `{"memory":"BTC"}`},
+		}},
+	})
+	conv.AddToolResults([]openai.ChatCompletionMessageParamUnion{openai.ToolMessage("ok", "call_1")})
+	if err := conv.Save(db); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restored, err := llm.RestoreConversation(db, "session-1")
+	if err != nil {
+		t.Fatalf("RestoreConversation failed: %v", err)
+	}
+	msgs := restored.Messages()
+	if restored.System() != "sys" || len(msgs) != 3 {
+		t.Fatalf("Restored conversation mismatch: %q %+v", restored.System(), msgs)
+	}
+	if msgs[1].ToolCalls[0].Name != "save_memory" || msgs[2].ToolCallID != "call_1" {
+		t.Errorf("Tool calls not restored: %+v", msgs)
+	}
+
+	// 再次保存会替换旧快照
+	restored.AddUser("and ETH")
+	if err := restored.Save(db); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if n := db.Count(func(*jsondb.Record) bool { return true }); n != 1 {
+		t.Errorf("Expected a single snapshot per conversation, got %d", n)
+	}
+	again, err := llm.RestoreConversation(db, "session-1")
+	if err != nil || len(again.Messages()) != 4 {
+		t.Fatalf("Expected the latest snapshot, got %v", err)
+	}
+
+	// 共用数据库时不影响其他带 id 字段的记录
+	if err := db.Add(map[string]string{"id": "session-1", "note": "unrelated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Save(db); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if n := db.Count(func(*jsondb.Record) bool { return true }); n != 2 {
+		t.Errorf("Expected the unrelated record to survive, got %d records", n)
+	}
+
+	if _, err := llm.RestoreConversation(db, "missing"); err != llm.ErrConversationNotFound {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+}
@@ -2,37 +2,249 @@ package llm
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
 
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/packages/param"
+	"github.com/Cai-ki/cage/jsondb"
 )
 
-func (c *LLMClient) embedding(text string) ([]float32, error) {
-	return c.embeddingWithDim(text, c.cfg.EmbedDim)
-}
-
-func (c *LLMClient) embeddingWithDim(text string, dimensions int) ([]float32, error) {
-	resp, err := c.openai.Embeddings.New(
-		context.Background(),
-		openai.EmbeddingNewParams{
-			Input: openai.EmbeddingNewParamsInputUnion{
-				OfString: param.Opt[string]{Value: text},
-			},
-			Model:      c.cfg.EmbedModel,
-			Dimensions: param.NewOpt(int64(dimensions)),
-		},
-	)
+const (
+	defaultEmbedBatchSize   = 64
+	defaultEmbedBatchTokens = 8000
+)
+
+// EmbeddingCache stores vectors keyed by EmbeddingKey, so text that was
+// already embedded is not paid for again.
+type EmbeddingCache interface {
+	Get(key string) ([]float32, bool)
+	Set(key string, vec []float32) error
+}
+
+// BatchEmbeddingCache is an EmbeddingCache that can store many vectors at
+// once. EmbeddingBatch uses it to write each batch in a single call.
+type BatchEmbeddingCache interface {
+	EmbeddingCache
+	SetMany(vecs map[string][]float32) error
+}
+
+// EmbeddingKey hashes the model, dimension and text into a cache key.
+func EmbeddingKey(model string, dimensions int, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + strconv.Itoa(dimensions) + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryEmbeddingCache is an in-process EmbeddingCache.
+type MemoryEmbeddingCache struct {
+	mu   sync.RWMutex
+	vecs map[string][]float32
+}
+
+// NewMemoryEmbeddingCache creates an empty in-memory cache.
+func NewMemoryEmbeddingCache() *MemoryEmbeddingCache {
+	return &MemoryEmbeddingCache{vecs: make(map[string][]float32)}
+}
+
+func (m *MemoryEmbeddingCache) Get(key string) ([]float32, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	vec, ok := m.vecs[key]
+	return vec, ok
+}
+
+func (m *MemoryEmbeddingCache) Set(key string, vec []float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.vecs[key] = vec
+	return nil
+}
+
+func (m *MemoryEmbeddingCache) SetMany(vecs map[string][]float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, vec := range vecs {
+		m.vecs[key] = vec
+	}
+	return nil
+}
+
+// JSONDBEmbeddingCache persists vectors in a jsondb database and keeps an
+// in-memory index of them.
+type JSONDBEmbeddingCache struct {
+	mu  sync.Mutex // serialises writes so concurrent batches do not add the same key twice
+	db  *jsondb.Database
+	mem *MemoryEmbeddingCache
+}
+
+type embeddingCacheEntry struct {
+	Key    string    `json:"key"`
+	Vector []float32 `json:"vector"`
+}
+
+// NewJSONDBEmbeddingCache loads all cached vectors from db.
+func NewJSONDBEmbeddingCache(db *jsondb.Database) (*JSONDBEmbeddingCache, error) {
+	var entries []embeddingCacheEntry
+	if err := db.GetByCondition(func(*jsondb.Record) bool { return true }, &entries); err != nil {
+		return nil, err
+	}
+	mem := NewMemoryEmbeddingCache()
+	for _, e := range entries {
+		mem.vecs[e.Key] = e.Vector
+	}
+	return &JSONDBEmbeddingCache{db: db, mem: mem}, nil
+}
+
+func (j *JSONDBEmbeddingCache) Get(key string) ([]float32, bool) {
+	return j.mem.Get(key)
+}
+
+func (j *JSONDBEmbeddingCache) Set(key string, vec []float32) error {
+	return j.SetMany(map[string][]float32{key: vec})
+}
+
+// SetMany stores the vectors that are not cached yet with a single database
+// write, since every jsondb write rewrites the whole file.
+func (j *JSONDBEmbeddingCache) SetMany(vecs map[string][]float32) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []interface{}
+	fresh := make(map[string][]float32, len(vecs))
+	for key, vec := range vecs {
+		if _, ok := j.mem.Get(key); ok {
+			continue
+		}
+		entries = append(entries, embeddingCacheEntry{Key: key, Vector: vec})
+		fresh[key] = vec
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := j.db.AddMany(entries...); err != nil {
+		return err
+	}
+	return j.mem.SetMany(fresh)
+}
+
+// SetEmbeddingCache enables caching of embeddings for this client; nil disables it.
+func (c *LLMClient) SetEmbeddingCache(cache EmbeddingCache) {
+	c.embedCache = cache
+}
+
+// Embedding returns a vector representation of the input text.
+func (c *LLMClient) Embedding(text string) ([]float32, error) {
+	return c.EmbeddingWithDim(text, c.cfg.EmbedDim)
+}
+
+// EmbeddingWithDim returns embedding vector with specified dimension.
+func (c *LLMClient) EmbeddingWithDim(text string, dimensions int) ([]float32, error) {
+	vecs, err := c.EmbeddingBatchWithDim([]string{text}, dimensions)
 	if err != nil {
 		return nil, err
 	}
-	if len(resp.Data) == 0 {
-		return nil, ErrUnexpectedResponse
+	return vecs[0], nil
+}
+
+// EmbeddingBatch embeds texts, returning vectors in the same order. Cached
+// texts are skipped and the rest are sent in chunks that respect
+// Config.EmbedBatchSize and a token budget per request. New vectors are
+// written to the cache once per call, in one SetMany when it is supported.
+func (c *LLMClient) EmbeddingBatch(texts []string) ([][]float32, error) {
+	return c.EmbeddingBatchWithDim(texts, c.cfg.EmbedDim)
+}
+
+// EmbeddingBatchWithDim is EmbeddingBatch with an explicit dimension.
+func (c *LLMClient) EmbeddingBatchWithDim(texts []string, dimensions int) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+
+	// Duplicate texts within a batch are requested once
+	pending := map[string][]int{}
+	var order []string
+	for i, text := range texts {
+		keys[i] = EmbeddingKey(c.cfg.EmbedModel, dimensions, text)
+		if c.embedCache != nil {
+			if vec, ok := c.embedCache.Get(keys[i]); ok {
+				result[i] = vec
+				continue
+			}
+		}
+		if _, ok := pending[keys[i]]; !ok {
+			order = append(order, keys[i])
+		}
+		pending[keys[i]] = append(pending[keys[i]], i)
+	}
+
+	fresh := make(map[string][]float32, len(order))
+	for _, chunk := range c.embeddingChunks(order, func(key string) string { return texts[pending[key][0]] }) {
+		inputs := make([]string, len(chunk))
+		for i, key := range chunk {
+			inputs[i] = texts[pending[key][0]]
+		}
+		vecs, err := c.requestEmbeddings(inputs, dimensions)
+		if err != nil {
+			// Keep what was already paid for
+			c.cacheEmbeddings(fresh)
+			return nil, err
+		}
+		for i, key := range chunk {
+			for _, idx := range pending[key] {
+				result[idx] = vecs[i]
+			}
+			fresh[key] = vecs[i]
+		}
+	}
+	c.cacheEmbeddings(fresh)
+	return result, nil
+}
+
+// cacheEmbeddings stores new vectors in the embedding cache, if any. The
+// vectors are already paid for, so a cache failure is logged rather than
+// returned.
+func (c *LLMClient) cacheEmbeddings(vecs map[string][]float32) {
+	if c.embedCache == nil || len(vecs) == 0 {
+		return
 	}
-	// Note: The openai-go SDK returns []float64, convert to []float32 if needed
-	embedding := resp.Data[0].Embedding
-	float32Embedding := make([]float32, len(embedding))
-	for i, v := range embedding {
-		float32Embedding[i] = float32(v)
+	if batch, ok := c.embedCache.(BatchEmbeddingCache); ok {
+		if err := batch.SetMany(vecs); err != nil {
+			log.Printf("llm: cache embeddings: %v", err)
+		}
+		return
 	}
-	return float32Embedding, nil
+	for key, vec := range vecs {
+		if err := c.embedCache.Set(key, vec); err != nil {
+			log.Printf("llm: cache embeddings: %v", err)
+			return
+		}
+	}
+}
+
+// embeddingChunks splits keys into request-sized groups.
+func (c *LLMClient) embeddingChunks(keys []string, text func(string) string) [][]string {
+	size := c.cfg.EmbedBatchSize
+	if size <= 0 {
+		size = defaultEmbedBatchSize
+	}
+
+	var chunks [][]string
+	var cur []string
+	tokens := 0
+	for _, key := range keys {
+		n := EstimateTokens(text(key))
+		if len(cur) > 0 && (len(cur) >= size || tokens+n > defaultEmbedBatchTokens) {
+			chunks = append(chunks, cur)
+			cur, tokens = nil, 0
+		}
+		cur = append(cur, key)
+		tokens += n
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+func (c *LLMClient) requestEmbeddings(inputs []string, dimensions int) ([][]float32, error) {
+	return c.provider.Embed(context.Background(), c.cfg.EmbedModel, inputs, dimensions)
 }
@@ -0,0 +1,188 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cai-ki/cage/jsondb"
+	"github.com/Cai-ki/cage/llm"
+)
+
+// newEmbeddingServer 返回的向量为 [len(text), 1]，并记录每次请求的输入
+func newEmbeddingServer(t *testing.T, batchSize int) (*llm.LLMClient, *[][]string) {
+	t.Helper()
+	var requests [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req.Input)
+
+		var data []string
+		for i, text := range req.Input {
+			data = append(data, fmt.Sprintf(`{"object":"embedding","index":%d,"embedding":[%d,1]}`, i, len(text)))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"object":"list","model":"test","data":[%s],"usage":{"prompt_tokens":0,"total_tokens":0}}`, strings.Join(data, ","))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := llm.NewClient(&llm.Config{APIKey: "test", BaseURL: srv.URL, EmbedModel: "test", EmbedBatchSize: batchSize})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return client, &requests
+}
+
+func TestEmbeddingBatch(t *testing.T) {
+	client, requests := newEmbeddingServer(t, 2)
+	client.SetEmbeddingCache(llm.NewMemoryEmbeddingCache())
+
+	vecs, err := client.EmbeddingBatch([]string{"a", "bb", "ccc", "a", "dddd"})
+	if err != nil {
+		t.Fatalf("EmbeddingBatch failed: %v", err)
+	}
+	for i, want := range []float32{1, 2, 3, 1, 4} {
+		if vecs[i][0] != want {
+			t.Errorf("Vector %d: expected %v, got %v", i, want, vecs[i][0])
+		}
+	}
+	// 4 个不同文本，每批 2 个
+	if len(*requests) != 2 {
+		t.Errorf("Expected 2 requests, got %d: %v", len(*requests), *requests)
+	}
+
+	if _, err := client.EmbeddingBatch([]string{"bb", "eeeee"}); err != nil {
+		t.Fatalf("EmbeddingBatch failed: %v", err)
+	}
+	last := (*requests)[len(*requests)-1]
+	if len(last) != 1 || last[0] != "eeeee" {
+		t.Errorf("Cached text should not be requested again, got %v", last)
+	}
+}
+
+// countingCache 记录 SetMany 的调用次数
+type countingCache struct {
+	*llm.MemoryEmbeddingCache
+	batches int
+}
+
+func (c *countingCache) SetMany(vecs map[string][]float32) error {
+	c.batches++
+	return c.MemoryEmbeddingCache.SetMany(vecs)
+}
+
+func TestEmbeddingBatchCachesOnce(t *testing.T) {
+	client, requests := newEmbeddingServer(t, 1)
+	cache := &countingCache{MemoryEmbeddingCache: llm.NewMemoryEmbeddingCache()}
+	client.SetEmbeddingCache(cache)
+
+	if _, err := client.EmbeddingBatch([]string{"a", "bb", "ccc"}); err != nil {
+		t.Fatalf("EmbeddingBatch failed: %v", err)
+	}
+	if len(*requests) != 3 || cache.batches != 1 {
+		t.Errorf("Expected 3 requests and 1 cache write, got %d and %d", len(*requests), cache.batches)
+	}
+	if _, ok := cache.Get(llm.EmbeddingKey("test", 0, "ccc")); !ok {
+		t.Error("Expected vectors to be cached")
+	}
+}
+
+// brokenCache 写入总是失败
+type brokenCache struct{ *llm.MemoryEmbeddingCache }
+
+func (brokenCache) SetMany(map[string][]float32) error { return errors.New("disk full") }
+
+func TestEmbeddingBatchCacheError(t *testing.T) {
+	client, _ := newEmbeddingServer(t, 2)
+	client.SetEmbeddingCache(brokenCache{llm.NewMemoryEmbeddingCache()})
+	vecs, err := client.EmbeddingBatch([]string{"a", "bb"})
+	if err != nil || len(vecs) != 2 || vecs[1][0] != 2 {
+		t.Errorf("Expected vectors despite cache failure, got %v (%v)", vecs, err)
+	}
+}
+
+func TestJSONDBEmbeddingCache(t *testing.T) {
+	defer os.Remove("test_embedding_cache.db")
+	db, err := jsondb.NewDatabase("test_embedding_cache.db")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	cache, err := llm.NewJSONDBEmbeddingCache(db)
+	if err != nil {
+		t.Fatalf("NewJSONDBEmbeddingCache failed: %v", err)
+	}
+	key := llm.EmbeddingKey("test", 0, "hello")
+	if err := cache.Set(key, []float32{1, 2}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	db, _ = jsondb.NewDatabase("test_embedding_cache.db")
+	reloaded, err := llm.NewJSONDBEmbeddingCache(db)
+	if err != nil {
+		t.Fatalf("NewJSONDBEmbeddingCache failed: %v", err)
+	}
+	vec, ok := reloaded.Get(key)
+	if !ok || len(vec) != 2 || vec[1] != 2 {
+		t.Errorf("Expected cached vector after reload, got %v %v", vec, ok)
+	}
+
+	// SetMany 只写入尚未缓存的向量
+	other := llm.EmbeddingKey("test", 0, "world")
+	if err := reloaded.SetMany(map[string][]float32{key: {9, 9}, other: {3, 4}}); err != nil {
+		t.Fatalf("SetMany failed: %v", err)
+	}
+	if n := db.Count(func(*jsondb.Record) bool { return true }); n != 2 {
+		t.Errorf("Expected 2 records after SetMany, got %d", n)
+	}
+	db, _ = jsondb.NewDatabase("test_embedding_cache.db")
+	reloaded, _ = llm.NewJSONDBEmbeddingCache(db)
+	if vec, ok := reloaded.Get(other); !ok || vec[0] != 3 {
+		t.Errorf("Expected batched vector after reload, got %v %v", vec, ok)
+	}
+	if vec, _ := reloaded.Get(key); vec[0] != 1 {
+		t.Errorf("Existing vector must not be overwritten, got %v", vec)
+	}
+
+	// 并发写入同一批向量只保存一次
+	var wg sync.WaitGroup
+	same := map[string][]float32{llm.EmbeddingKey("test", 0, "again"): {5, 6}}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reloaded.SetMany(same)
+		}()
+	}
+	wg.Wait()
+	if n := db.Count(func(*jsondb.Record) bool { return true }); n != 3 {
+		t.Errorf("Expected no duplicate rows from concurrent SetMany, got %d", n)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if s := llm.CosineSimilarity([]float32{1, 0}, []float32{2, 0}); s < 0.999 {
+		t.Errorf("Expected similarity 1, got %v", s)
+	}
+	if s := llm.CosineSimilarity([]float32{1, 0}, []float32{0, 1}); s != 0 {
+		t.Errorf("Expected similarity 0, got %v", s)
+	}
+
+	n := llm.Normalize([]float32{3, 4})
+	if n[0] != 0.6 || n[1] != 0.8 {
+		t.Errorf("Expected [0.6 0.8], got %v", n)
+	}
+
+	matches := llm.TopK([]float32{1, 0}, [][]float32{{0, 1}, {1, 1}, {1, 0}}, 2)
+	if len(matches) != 2 || matches[0].Index != 2 || matches[1].Index != 1 {
+		t.Errorf("Unexpected top-k: %+v", matches)
+	}
+}
@@ -0,0 +1,319 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// EnsembleMember is one source of samples: a client (nil means the default
+// client), how many completions to draw from it and how much its answers count.
+type EnsembleMember struct {
+	Client  *LLMClient
+	Samples int            // 0 means 1
+	Weight  float64        // 0 means 1
+	Options []AllowedParam // extra per-member params, e.g. WithModel or WithTemperature
+}
+
+// Sample is one parsed completion.
+type Sample[T any] struct {
+	Member int // index into the members passed to RunEnsemble
+	Weight float64
+	Raw    string
+	Value  T
+	Err    error // request or parse failure; Value is zero
+}
+
+// Consensus is the aggregated answer. Agreement is in [0, 1]; callers should
+// refuse to act when it is below their threshold.
+type Consensus[T any] struct {
+	Value     T
+	Agreement float64
+	Samples   []Sample[T]
+}
+
+// Agreed reports whether the agreement reaches min.
+func (c *Consensus[T]) Agreed(min float64) bool {
+	return c.Agreement >= min
+}
+
+// Aggregator reduces the successful samples to one answer and its agreement.
+type Aggregator[T any] func(samples []Sample[T]) (T, float64, error)
+
+// RunEnsemble sends the same request to every member concurrently, parses each
+// reply as JSON into T and aggregates the results. The response cache is always
+// bypassed, otherwise every sample would be identical.
+func RunEnsemble[T any](members []EnsembleMember, aggregate Aggregator[T], args ...AllowedParam) (*Consensus[T], error) {
+	var samples []Sample[T]
+	for i, m := range members {
+		n := max(m.Samples, 1)
+		weight := m.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		for j := 0; j < n; j++ {
+			samples = append(samples, Sample[T]{Member: i, Weight: weight})
+		}
+	}
+
+	clients := make([]*LLMClient, len(members))
+	for i, m := range members {
+		client, err := clientOrDefault(m.Client)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = client
+	}
+
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Add(1)
+		go func(s *Sample[T]) {
+			defer wg.Done()
+			m := members[s.Member]
+			params := append(append(append([]AllowedParam{}, args...), m.Options...), BypassCache())
+			msg, err := clients[s.Member].CompletionByParams(params...)
+			if err != nil {
+				s.Err = err
+				return
+			}
+			s.Raw = msg.Content
+			s.Value, s.Err = ParseJSON[T](msg.Content)
+		}(&samples[i])
+	}
+	wg.Wait()
+
+	var ok []Sample[T]
+	for _, s := range samples {
+		if s.Err == nil {
+			ok = append(ok, s)
+		}
+	}
+	if len(ok) == 0 {
+		return &Consensus[T]{Samples: samples}, ErrNoConsensus
+	}
+
+	value, agreement, err := aggregate(ok)
+	if err != nil {
+		return &Consensus[T]{Samples: samples}, err
+	}
+	// Failed samples count as dissent
+	agreement *= float64(len(ok)) / float64(len(samples))
+	return &Consensus[T]{Value: value, Agreement: agreement, Samples: samples}, nil
+}
+
+// ParseJSON decodes the JSON object in a model reply, ignoring markdown code
+// fences and any text around it.
+func ParseJSON[T any](content string) (T, error) {
+	var v T
+	start := strings.IndexAny(content, "{[")
+	end := strings.LastIndexAny(content, "}]")
+	if start < 0 || end < start {
+		return v, fmt.Errorf("llm: no JSON in reply: %.80q", content)
+	}
+	err := json.Unmarshal([]byte(content[start:end+1]), &v)
+	return v, err
+}
+
+// MajorityVote groups samples by key, e.g. the trading action, and returns the
+// first answer of the heaviest group. Agreement is that group's share of the
+// total weight.
+func MajorityVote[T any](key func(T) string) Aggregator[T] {
+	return func(samples []Sample[T]) (T, float64, error) {
+		weights := map[string]float64{}
+		first := map[string]T{}
+		var order []string
+		var total float64
+		for _, s := range samples {
+			k := key(s.Value)
+			if _, seen := first[k]; !seen {
+				first[k] = s.Value
+				order = append(order, k)
+			}
+			weights[k] += s.Weight
+			total += s.Weight
+		}
+
+		// Ties go to the answer seen first
+		best := order[0]
+		for _, k := range order[1:] {
+			if weights[k] > weights[best] {
+				best = k
+			}
+		}
+		return first[best], weights[best] / total, nil
+	}
+}
+
+// WeightedAverage groups samples by their non-numeric fields, e.g. the trading
+// action, and averages every numeric field of the heaviest group by sample
+// weight; the other fields are taken from that group's heaviest sample.
+// Samples from other groups never enter the average. A sample agrees when it
+// is in the winning group and all of its numeric fields are within tolerance
+// (relative, e.g. 0.1 for 10%) of the average, and agreement is the weight
+// share of agreeing samples.
+func WeightedAverage[T any](tolerance float64) Aggregator[T] {
+	return func(samples []Sample[T]) (T, float64, error) {
+		var zero T
+		rt := reflect.TypeOf(zero)
+		if rt == nil || rt.Kind() != reflect.Struct {
+			return zero, 0, fmt.Errorf("llm: WeightedAverage needs a struct, got %v", rt)
+		}
+		fields := numericFields(rt)
+
+		// Group by the non-numeric fields; ties go to the group seen first
+		var groups [][]Sample[T]
+		var weights []float64
+		var total float64
+		for _, s := range samples {
+			total += s.Weight
+			g := 0
+			for g < len(groups) && !sameNonNumeric(groups[g][0].Value, s.Value, fields) {
+				g++
+			}
+			if g == len(groups) {
+				groups = append(groups, nil)
+				weights = append(weights, 0)
+			}
+			groups[g] = append(groups[g], s)
+			weights[g] += s.Weight
+		}
+		best := 0
+		for g := range groups {
+			if weights[g] > weights[best] {
+				best = g
+			}
+		}
+		group := groups[best]
+
+		heaviest := 0
+		for i, s := range group {
+			if s.Weight > group[heaviest].Weight {
+				heaviest = i
+			}
+		}
+		result := group[heaviest].Value
+		rv := reflect.ValueOf(&result).Elem()
+
+		means := make([]float64, len(fields))
+		for i, f := range fields {
+			for _, s := range group {
+				means[i] += numericValue(reflect.ValueOf(s.Value).Field(f)) * s.Weight
+			}
+			means[i] /= weights[best]
+			setNumeric(rv.Field(f), means[i])
+		}
+
+		var agreeing float64
+		for _, s := range group {
+			agrees := true
+			for i, f := range fields {
+				v := numericValue(reflect.ValueOf(s.Value).Field(f))
+				if math.Abs(v-means[i]) > tolerance*math.Max(math.Abs(means[i]), 1e-9) {
+					agrees = false
+					break
+				}
+			}
+			if agrees {
+				agreeing += s.Weight
+			}
+		}
+		return result, agreeing / total, nil
+	}
+}
+
+// sameNonNumeric reports whether a and b are equal in every exported field
+// that is not in numeric.
+func sameNonNumeric[T any](a, b T, numeric []int) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	skip := make(map[int]bool, len(numeric))
+	for _, f := range numeric {
+		skip[f] = true
+	}
+	for i := 0; i < va.NumField(); i++ {
+		if skip[i] || !va.Type().Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+func numericFields(t reflect.Type) []int {
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
+
+func numericValue(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func setNumeric(v reflect.Value, f float64) {
+	switch {
+	case v.CanInt():
+		v.SetInt(int64(math.Round(f)))
+	case v.CanUint():
+		v.SetUint(uint64(math.Round(f)))
+	default:
+		v.SetFloat(f)
+	}
+}
+
+// Judge asks client (nil means the default client) to pick or merge the
+// answers. The judge replies with {"answer": <T>, "agreement": <0..1>}.
+func Judge[T any](client *LLMClient, instruction string) Aggregator[T] {
+	return func(samples []Sample[T]) (T, float64, error) {
+		var zero T
+		judge, err := clientOrDefault(client)
+		if err != nil {
+			return zero, 0, err
+		}
+		answers := make([]T, len(samples))
+		for i, s := range samples {
+			answers[i] = s.Value
+		}
+		data, err := json.Marshal(answers)
+		if err != nil {
+			return zero, 0, err
+		}
+
+		prompt := instruction + "\n\nCandidate answers (JSON):\n" + string(data) +
+			"\n\nReply with only a JSON object {\"answer\": <the final answer in the same shape>, " +
+			"\"agreement\": <how much the candidates agree, from 0 to 1>}."
+		msg, err := judge.CompletionByParams(UserMessage(prompt), BypassCache())
+		if err != nil {
+			return zero, 0, err
+		}
+		verdict, err := ParseJSON[struct {
+			Answer    T       `json:"answer"`
+			Agreement float64 `json:"agreement"`
+		}](msg.Content)
+		if err != nil {
+			return zero, 0, err
+		}
+		return verdict.Answer, math.Min(math.Max(verdict.Agreement, 0), 1), nil
+	}
+}
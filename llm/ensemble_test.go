@@ -0,0 +1,109 @@
+package llm_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+type decision struct {
+	Action   string  `json:"action"`
+	Quantity float64 `json:"quantity"`
+}
+
+func TestEnsembleMajorityVote(t *testing.T) {
+	fake := llm.NewFake(
+		llm.ReplyText("```json\n{\"action\":\"buy\",\"quantity\":0.01}\n```"),
+		llm.ReplyText(`{"action":"buy","quantity":0.02}`),
+		llm.ReplyText(`I think {"action":"hold","quantity":0}`),
+		llm.ReplyText("not json"),
+	)
+	client := fake.Client()
+	client.SetResponseCache(llm.NewLRUResponseCache(10, time.Hour))
+
+	res, err := llm.RunEnsemble(
+		[]llm.EnsembleMember{{Client: client, Samples: 4}},
+		llm.MajorityVote(func(d decision) string { return d.Action }),
+		llm.UserMessage("decide"),
+	)
+	if err != nil {
+		t.Fatalf("RunEnsemble failed: %v", err)
+	}
+	if len(fake.Requests()) != 4 {
+		t.Errorf("Expected the cache to be bypassed, got %d requests", len(fake.Requests()))
+	}
+	if res.Value.Action != "buy" || res.Agreement != 0.5 || len(res.Samples) != 4 {
+		t.Errorf("Unexpected consensus: %+v (agreement %v)", res.Value, res.Agreement)
+	}
+	if res.Agreed(0.6) {
+		t.Error("Agreement of 0.5 should not pass a 0.6 threshold")
+	}
+}
+
+func TestEnsembleWeightedAverage(t *testing.T) {
+	a := llm.NewFake(llm.ReplyText(`{"action":"buy","quantity":1}`))
+	b := llm.NewFake(llm.ReplyText(`{"action":"sell","quantity":4}`))
+	c := llm.NewFake(llm.ReplyText(`{"action":"buy","quantity":4}`))
+
+	res, err := llm.RunEnsemble(
+		[]llm.EnsembleMember{{Client: a.Client(), Weight: 2}, {Client: b.Client()}, {Client: c.Client()}},
+		llm.WeightedAverage[decision](0.5),
+		llm.UserMessage("decide"),
+	)
+	if err != nil {
+		t.Fatalf("RunEnsemble failed: %v", err)
+	}
+	// 只对 buy 的样本求均值：(1*2 + 4) / 3，sell 的数量不参与
+	if res.Value.Quantity != 2 || res.Value.Action != "buy" {
+		t.Errorf("Expected weighted mean 2 of the buy samples, got %+v", res.Value)
+	}
+	// 只有权重为 2 的样本在均值 50% 以内，sell 计为不同意
+	if math.Abs(res.Agreement-2.0/4) > 1e-9 {
+		t.Errorf("Expected agreement 1/2, got %v", res.Agreement)
+	}
+}
+
+func TestEnsembleDefaultClientError(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "unknown")
+	llm.SetDefaultClient(nil)
+	defer llm.SetDefaultClient(nil)
+
+	if _, err := llm.RunEnsemble([]llm.EnsembleMember{{}}, llm.MajorityVote(func(d decision) string { return d.Action }),
+		llm.UserMessage("decide")); err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Errorf("Expected default client error, got %v", err)
+	}
+
+	fake := llm.NewFake(llm.ReplyText(`{"action":"buy","quantity":1}`))
+	if _, err := llm.RunEnsemble([]llm.EnsembleMember{{Client: fake.Client()}}, llm.Judge[decision](nil, "pick"),
+		llm.UserMessage("decide")); err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Errorf("Expected default judge error, got %v", err)
+	}
+}
+
+func TestEnsembleJudge(t *testing.T) {
+	judge := llm.NewFake(llm.ReplyText(`{"answer":{"action":"hold","quantity":0},"agreement":0.3}`))
+	fake := llm.NewFake(
+		llm.ReplyText(`{"action":"buy","quantity":1}`),
+		llm.ReplyText(`{"action":"sell","quantity":1}`),
+	)
+
+	res, err := llm.RunEnsemble(
+		[]llm.EnsembleMember{{Client: fake.Client(), Samples: 2}},
+		llm.Judge[decision](judge.Client(), "Pick the safest decision."),
+		llm.UserMessage("decide"),
+	)
+	if err != nil {
+		t.Fatalf("RunEnsemble failed: %v", err)
+	}
+	if res.Value.Action != "hold" || res.Agreement != 0.3 {
+		t.Errorf("Unexpected verdict: %+v (agreement %v)", res.Value, res.Agreement)
+	}
+
+	none := llm.NewFake(llm.ReplyText("no idea"))
+	if _, err := llm.RunEnsemble([]llm.EnsembleMember{{Client: none.Client()}}, llm.MajorityVote(func(d decision) string { return d.Action }), llm.UserMessage("decide")); err != llm.ErrNoConsensus {
+		t.Errorf("Expected ErrNoConsensus, got %v", err)
+	}
+}
@@ -3,5 +3,10 @@ package llm
 import "errors"
 
 var (
-	ErrUnexpectedResponse = errors.New("llm: unexpected API response")
+	ErrUnexpectedResponse   = errors.New("llm: unexpected API response")
+	ErrConversationNotFound = errors.New("llm: conversation not found")
+	ErrFakeExhausted        = errors.New("llm: fake has no scripted reply left")
+	ErrNotSupported         = errors.New("llm: operation not supported by provider")
+	ErrBlocked              = errors.New("llm: blocked by guardrail")
+	ErrNoConsensus          = errors.New("llm: no ensemble sample could be parsed")
 )
@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FakeReply is one scripted answer of a Fake.
+type FakeReply struct {
+	Content    string      // chat reply text
+	ToolCalls  []ToolCall  // chat reply tool calls
+	Embeddings [][]float32 // answer to an embeddings request
+	Status     int         // non-zero and >= 400 to simulate an API error
+	Error      string      // error message when Status is set
+}
+
+// ReplyText scripts a plain text chat reply.
+func ReplyText(content string) FakeReply {
+	return FakeReply{Content: content}
+}
+
+// ReplyToolCalls scripts a chat reply that requests tool calls.
+func ReplyToolCalls(calls ...ToolCall) FakeReply {
+	return FakeReply{ToolCalls: calls}
+}
+
+// ReplyError scripts an API error with the given HTTP status.
+func ReplyError(status int, msg string) FakeReply {
+	return FakeReply{Status: status, Error: msg}
+}
+
+// FakeRequest is a request received by a Fake.
+type FakeRequest struct {
+	Path string
+	Body []byte
+}
+
+// Decode unmarshals the JSON request body into v.
+func (r FakeRequest) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Fake is a scripted http.RoundTripper for unit tests. Each API request
+// consumes the next reply in order and is kept for inspection.
+type Fake struct {
+	mu       sync.Mutex
+	replies  []FakeReply
+	requests []FakeRequest
+}
+
+// NewFake creates a Fake that answers with replies in order.
+func NewFake(replies ...FakeReply) *Fake {
+	return &Fake{replies: replies}
+}
+
+// Push appends more scripted replies.
+func (f *Fake) Push(replies ...FakeReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies = append(f.replies, replies...)
+}
+
+// Requests returns the requests received so far.
+func (f *Fake) Requests() []FakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeRequest(nil), f.requests...)
+}
+
+// Client returns an LLMClient that talks only to the Fake.
+func (f *Fake) Client() *LLMClient {
+	c, _ := NewClient(&Config{
+		APIKey:      "fake",
+		Model:       "fake",
+		VisionModel: "fake",
+		EmbedModel:  "fake",
+		TopP:        1,
+	}, WithTransport(f))
+	return c
+}
+
+func (f *Fake) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, FakeRequest{Path: req.URL.Path, Body: body})
+	if len(f.replies) == 0 {
+		f.mu.Unlock()
+		return errorResponse(req, http.StatusInternalServerError, ErrFakeExhausted.Error()), nil
+	}
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+	f.mu.Unlock()
+
+	if reply.Status >= 400 {
+		return errorResponse(req, reply.Status, reply.Error), nil
+	}
+
+	var data []byte
+	if strings.HasSuffix(req.URL.Path, "/embeddings") {
+		data, err = reply.embeddingResponse()
+	} else {
+		data, err = reply.chatResponse()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fixtureResponse{
+		Status: http.StatusOK,
+		Header: map[string]string{"Content-Type": "application/json"},
+		Body:   string(data),
+	}.httpResponse(req), nil
+}
+
+func (r FakeReply) chatResponse() ([]byte, error) {
+	msg := map[string]any{"role": "assistant", "content": r.Content}
+	finish := "stop"
+	if len(r.ToolCalls) > 0 {
+		var calls []map[string]any
+		for i, tc := range r.ToolCalls {
+			id := tc.ID
+			if id == "" {
+				id = fmt.Sprintf("call_%d", i)
+			}
+			calls = append(calls, map[string]any{
+				"id":       id,
+				"type":     "function",
+				"function": map[string]string{"name": tc.Name, "arguments": tc.Arguments},
+			})
+		}
+		msg["tool_calls"] = calls
+		finish = "tool_calls"
+	}
+	return json.Marshal(map[string]any{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   "fake",
+		"choices": []map[string]any{{"index": 0, "message": msg, "finish_reason": finish}},
+	})
+}
+
+func (r FakeReply) embeddingResponse() ([]byte, error) {
+	data := []map[string]any{}
+	for i, vec := range r.Embeddings {
+		data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": vec})
+	}
+	return json.Marshal(map[string]any{
+		"object": "list",
+		"model":  "fake",
+		"data":   data,
+		"usage":  map[string]int{"prompt_tokens": 0, "total_tokens": 0},
+	})
+}
@@ -0,0 +1,46 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+func TestFakeScriptedReplies(t *testing.T) {
+	fake := llm.NewFake(
+		llm.ReplyToolCalls(llm.ToolCall{Name: "add", Arguments: `{"a":1,"b":1}`}),
+		llm.ReplyText("2"),
+	)
+	llm.SetDefaultClient(fake.Client())
+	defer llm.SetDefaultClient(nil)
+
+	msg, err := llm.CompletionByParams(llm.UserMessage("1 + 1 = ?"))
+	if err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "add" {
+		t.Fatalf("Expected add tool call, got %+v", msg.ToolCalls)
+	}
+
+	txt, err := llm.Completion("again")
+	if err != nil || txt != "2" {
+		t.Fatalf("Expected '2', got %q (%v)", txt, err)
+	}
+
+	if _, err := llm.Completion("no more"); err == nil {
+		t.Error("Expected error once the script is exhausted")
+	}
+
+	var req struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	requests := fake.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+	if err := requests[1].Decode(&req); err != nil || req.Messages[0].Content != "again" {
+		t.Errorf("Unexpected second request: %s", requests[1].Body)
+	}
+}
@@ -0,0 +1,500 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/param"
+)
+
+// Guard is one step of the guardrails chain run by CompletionByParams.
+// Before sees the request and After the reply; either may be nil. A hook
+// returns a non-empty note when it changed something, or an error to block the
+// exchange (wrapped in ErrBlocked).
+type Guard struct {
+	Name   string
+	Before func(params *openai.ChatCompletionNewParams) (note string, err error)
+	After  func(msg *openai.ChatCompletionMessage) (note string, err error)
+}
+
+// Intervention records a guard that modified or blocked an exchange.
+type Intervention struct {
+	Guard  string    `json:"guard"`
+	Stage  string    `json:"stage"`  // input or output
+	Action string    `json:"action"` // modified or blocked
+	Detail string    `json:"detail"`
+	Time   time.Time `json:"time"`
+}
+
+// WithGuards runs the guards, in order, around every CompletionByParams call.
+func WithGuards(guards ...Guard) ClientOption {
+	return func(c *LLMClient) {
+		c.guards = append(c.guards, guards...)
+	}
+}
+
+// WithGuardLogger receives every intervention; the default logs it with the
+// standard logger.
+func WithGuardLogger(fn func(Intervention)) ClientOption {
+	return func(c *LLMClient) {
+		c.guardLog = fn
+	}
+}
+
+// Use appends guards to the client's chain.
+func (c *LLMClient) Use(guards ...Guard) {
+	c.guards = append(c.guards, guards...)
+}
+
+func (c *LLMClient) intervene(guard, stage, action, detail string) {
+	i := Intervention{Guard: guard, Stage: stage, Action: action, Detail: detail, Time: time.Now()}
+	if c.guardLog != nil {
+		c.guardLog(i)
+		return
+	}
+	log.Printf("llm: guard %s %s %s: %s", i.Guard, i.Action, i.Stage, i.Detail)
+}
+
+// guardedChat runs the Before hooks, the request and then the After hooks.
+func (c *LLMClient) guardedChat(params openai.ChatCompletionNewParams, opts *callOptions) (openai.ChatCompletionMessage, error) {
+	for _, g := range c.guards {
+		if g.Before == nil {
+			continue
+		}
+		note, err := g.Before(&params)
+		if err != nil {
+			c.intervene(g.Name, "input", "blocked", err.Error())
+			return openai.ChatCompletionMessage{}, fmt.Errorf("%w: %s: %v", ErrBlocked, g.Name, err)
+		}
+		if note != "" {
+			c.intervene(g.Name, "input", "modified", note)
+		}
+	}
+
+	msg, err := c.cachedChat(params, opts)
+	if err != nil {
+		return msg, err
+	}
+
+	for _, g := range c.guards {
+		if g.After == nil {
+			continue
+		}
+		note, err := g.After(&msg)
+		if err != nil {
+			c.intervene(g.Name, "output", "blocked", err.Error())
+			return openai.ChatCompletionMessage{}, fmt.Errorf("%w: %s: %v", ErrBlocked, g.Name, err)
+		}
+		if note != "" {
+			c.intervene(g.Name, "output", "modified", note)
+		}
+	}
+	return msg, nil
+}
+
+// DefaultRedactions match API keys, bearer tokens, private keys, e-mail
+// addresses, card numbers and phone numbers. Card and phone patterns require
+// separators or a country/mobile prefix so prices and timestamps are kept.
+var DefaultRedactions = map[string]*regexp.Regexp{
+	"api_key":     regexp.MustCompile(`\b(sk|pk|rk)-[A-Za-z0-9_-]{16,}\b|\bAKIA[0-9A-Z]{16}\b`),
+	"bearer":      regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]{16,}`),
+	"private_key": regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	"email":       regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	"card":        regexp.MustCompile(`\b\d{4}[ -]\d{4}[ -]\d{4}[ -]\d{1,4}\b`),
+	"phone":       regexp.MustCompile(`\+\d{1,3}[ -]?\d{2,4}[ -]?\d{3,4}[ -]?\d{3,4}\b|\b1[3-9]\d{9}\b`),
+}
+
+// Redact replaces matches of the patterns (DefaultRedactions when none are
+// given) in every request message, including tool-call arguments and tool
+// results, with "[REDACTED:<name>]". Pass extra literal secrets, such as the
+// exchange API key, as patterns of their own.
+func Redact(patterns map[string]*regexp.Regexp) Guard {
+	if len(patterns) == 0 {
+		patterns = DefaultRedactions
+	}
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Guard{
+		Name: "redact",
+		Before: func(params *openai.ChatCompletionNewParams) (string, error) {
+			counts := map[string]int{}
+			replace := func(s string) string {
+				for _, name := range names {
+					s = patterns[name].ReplaceAllStringFunc(s, func(string) string {
+						counts[name]++
+						return "[REDACTED:" + name + "]"
+					})
+				}
+				return s
+			}
+			for i, m := range params.Messages {
+				params.Messages[i] = mapMessageText(m, replace)
+			}
+			if len(counts) == 0 {
+				return "", nil
+			}
+			notes := []string{}
+			for _, name := range names {
+				if n := counts[name]; n > 0 {
+					notes = append(notes, fmt.Sprintf("%s x%d", name, n))
+				}
+			}
+			return "redacted " + strings.Join(notes, ", "), nil
+		},
+	}
+}
+
+// RedactLiteral builds a pattern that matches the exact secret s.
+func RedactLiteral(s string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(s))
+}
+
+// MaxPromptTokens blocks requests whose messages are estimated above limit.
+func MaxPromptTokens(limit int) Guard {
+	return Guard{
+		Name: "max_prompt_tokens",
+		Before: func(params *openai.ChatCompletionNewParams) (string, error) {
+			total := 0
+			for _, m := range params.Messages {
+				mapMessageText(m, func(s string) string {
+					total += EstimateTokens(s)
+					return s
+				})
+			}
+			if total > limit {
+				return "", fmt.Errorf("prompt has ~%d tokens, limit is %d", total, limit)
+			}
+			return "", nil
+		},
+	}
+}
+
+// RequirePattern blocks replies whose content does not match re.
+func RequirePattern(re *regexp.Regexp) Guard {
+	return Guard{
+		Name: "require_pattern",
+		After: func(msg *openai.ChatCompletionMessage) (string, error) {
+			if !re.MatchString(msg.Content) {
+				return "", fmt.Errorf("reply does not match %s", re)
+			}
+			return "", nil
+		},
+	}
+}
+
+// RejectPattern blocks replies whose content matches re.
+func RejectPattern(re *regexp.Regexp) Guard {
+	return Guard{
+		Name: "reject_pattern",
+		After: func(msg *openai.ChatCompletionMessage) (string, error) {
+			if loc := re.FindStringIndex(msg.Content); loc != nil {
+				return "", fmt.Errorf("reply contains %q", msg.Content[loc[0]:loc[1]])
+			}
+			return "", nil
+		},
+	}
+}
+
+// OutputSchema requires the reply content to be JSON matching schema. With
+// repair, JSON wrapped in prose or code fences is extracted instead of blocked.
+func OutputSchema(schema map[string]any, repair bool) Guard {
+	return Guard{
+		Name: "output_schema",
+		After: func(msg *openai.ChatCompletionMessage) (string, error) {
+			var v any
+			note := ""
+			if err := json.Unmarshal([]byte(msg.Content), &v); err != nil {
+				if !repair {
+					return "", fmt.Errorf("reply is not JSON: %v", err)
+				}
+				raw, perr := ParseJSON[json.RawMessage](msg.Content)
+				if perr != nil || json.Unmarshal(raw, &v) != nil {
+					return "", fmt.Errorf("reply is not JSON: %v", err)
+				}
+				msg.Content = string(raw)
+				note = "extracted JSON from reply"
+			}
+			if err := ValidateSchema(v, schema); err != nil {
+				return "", err
+			}
+			return note, nil
+		},
+	}
+}
+
+// ToolArgsSchema requires the arguments of every call to tool to match schema.
+func ToolArgsSchema(tool string, schema map[string]any) Guard {
+	return Guard{
+		Name: "tool_args_schema",
+		After: func(msg *openai.ChatCompletionMessage) (string, error) {
+			for _, tc := range msg.ToolCalls {
+				if tc.Function.Name != tool {
+					continue
+				}
+				var args any
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+					return "", fmt.Errorf("%s: arguments are not JSON: %v", tool, err)
+				}
+				if err := ValidateSchema(args, schema); err != nil {
+					return "", fmt.Errorf("%s: %v", tool, err)
+				}
+			}
+			return "", nil
+		},
+	}
+}
+
+// ToolArgRange keeps the numeric argument field of tool within [min, max].
+// With clamp, out-of-range values are clamped instead of blocked, e.g. to cap
+// the quantity of a market order.
+func ToolArgRange(tool, field string, min, max float64, clamp bool) Guard {
+	return Guard{
+		Name: "tool_arg_range",
+		After: func(msg *openai.ChatCompletionMessage) (string, error) {
+			var notes []string
+			for i, tc := range msg.ToolCalls {
+				if tc.Function.Name != tool {
+					continue
+				}
+				var args map[string]any
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+					return "", fmt.Errorf("%s: arguments are not JSON: %v", tool, err)
+				}
+				v, ok := toFloat(args[field])
+				if !ok {
+					return "", fmt.Errorf("%s: %s is not a number: %v", tool, field, args[field])
+				}
+				if v >= min && v <= max {
+					continue
+				}
+				if !clamp {
+					return "", fmt.Errorf("%s: %s=%v outside [%v, %v]", tool, field, v, min, max)
+				}
+				clamped := math.Min(math.Max(v, min), max)
+				// Numbers sent as strings stay strings
+				if _, isString := args[field].(string); isString {
+					args[field] = fmt.Sprint(clamped)
+				} else {
+					args[field] = clamped
+				}
+				data, err := json.Marshal(args)
+				if err != nil {
+					return "", err
+				}
+				msg.ToolCalls[i].Function.Arguments = string(data)
+				notes = append(notes, fmt.Sprintf("%s: %s %v -> %v", tool, field, v, clamped))
+			}
+			return strings.Join(notes, "; "), nil
+		},
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ValidateSchema checks a decoded JSON value against the subset of JSON Schema
+// used for tool definitions: type, properties, required, enum, minimum,
+// maximum and items.
+func ValidateSchema(v any, schema map[string]any) error {
+	return validateSchema(v, schema, "$")
+}
+
+func validateSchema(v any, schema map[string]any, path string) error {
+	if t, ok := schema["type"].(string); ok && !schemaTypeMatches(v, t) {
+		return fmt.Errorf("%s: expected %s, got %T", path, t, v)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+		}
+	}
+	if n, ok := v.(float64); ok {
+		if min, ok := toFloat(schema["minimum"]); ok && n < min {
+			return fmt.Errorf("%s: %v is below minimum %v", path, n, min)
+		}
+		if max, ok := toFloat(schema["maximum"]); ok && n > max {
+			return fmt.Errorf("%s: %v is above maximum %v", path, n, max)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required field %q", path, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for name, sub := range props {
+			subSchema, ok := sub.(map[string]any)
+			if fv, present := val[name]; ok && present {
+				if err := validateSchema(fv, subSchema, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				if err := validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypeMatches(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+// schemaStrings accepts both []string (Go literals) and []any (decoded JSON).
+func schemaStrings(v any) []string {
+	switch s := v.(type) {
+	case []string:
+		return s
+	case []any:
+		out := make([]string, 0, len(s))
+		for _, e := range s {
+			if str, ok := e.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// mapMessageText returns a copy of m with f applied to every text content and
+// tool-call argument; the original is left untouched because callers may
+// reuse their params.
+func mapMessageText(m openai.ChatCompletionMessageParamUnion, f func(string) string) openai.ChatCompletionMessageParamUnion {
+	switch {
+	case m.OfSystem != nil:
+		v := *m.OfSystem
+		v.Content.OfString = mapOpt(v.Content.OfString, f)
+		v.Content.OfArrayOfContentParts = mapTextParts(v.Content.OfArrayOfContentParts, f)
+		return openai.ChatCompletionMessageParamUnion{OfSystem: &v}
+	case m.OfDeveloper != nil:
+		v := *m.OfDeveloper
+		v.Content.OfString = mapOpt(v.Content.OfString, f)
+		v.Content.OfArrayOfContentParts = mapTextParts(v.Content.OfArrayOfContentParts, f)
+		return openai.ChatCompletionMessageParamUnion{OfDeveloper: &v}
+	case m.OfTool != nil:
+		v := *m.OfTool
+		v.Content.OfString = mapOpt(v.Content.OfString, f)
+		v.Content.OfArrayOfContentParts = mapTextParts(v.Content.OfArrayOfContentParts, f)
+		return openai.ChatCompletionMessageParamUnion{OfTool: &v}
+	case m.OfAssistant != nil:
+		v := *m.OfAssistant
+		v.Content.OfString = mapOpt(v.Content.OfString, f)
+		if parts := v.Content.OfArrayOfContentParts; parts != nil {
+			v.Content.OfArrayOfContentParts = make([]openai.ChatCompletionAssistantMessageParamContentArrayOfContentPartUnion, len(parts))
+			for i, p := range parts {
+				if p.OfText != nil {
+					text := *p.OfText
+					text.Text = f(text.Text)
+					p.OfText = &text
+				}
+				v.Content.OfArrayOfContentParts[i] = p
+			}
+		}
+		// Tool-call arguments are sent back to the provider as well
+		if calls := v.ToolCalls; calls != nil {
+			v.ToolCalls = make([]openai.ChatCompletionMessageToolCallParam, len(calls))
+			for i, tc := range calls {
+				tc.Function.Arguments = f(tc.Function.Arguments)
+				v.ToolCalls[i] = tc
+			}
+		}
+		return openai.ChatCompletionMessageParamUnion{OfAssistant: &v}
+	case m.OfUser != nil:
+		v := *m.OfUser
+		v.Content.OfString = mapOpt(v.Content.OfString, f)
+		if parts := v.Content.OfArrayOfContentParts; parts != nil {
+			v.Content.OfArrayOfContentParts = make([]openai.ChatCompletionContentPartUnionParam, len(parts))
+			for i, p := range parts {
+				if p.OfText != nil {
+					text := *p.OfText
+					text.Text = f(text.Text)
+					p.OfText = &text
+				}
+				v.Content.OfArrayOfContentParts[i] = p
+			}
+		}
+		return openai.ChatCompletionMessageParamUnion{OfUser: &v}
+	}
+	return m
+}
+
+func mapOpt(s param.Opt[string], f func(string) string) param.Opt[string] {
+	if !s.Valid() {
+		return s
+	}
+	return openai.String(f(s.Value))
+}
+
+func mapTextParts(parts []openai.ChatCompletionContentPartTextParam, f func(string) string) []openai.ChatCompletionContentPartTextParam {
+	if parts == nil {
+		return nil
+	}
+	out := make([]openai.ChatCompletionContentPartTextParam, len(parts))
+	for i, p := range parts {
+		p.Text = f(p.Text)
+		out[i] = p
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package llm_test
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+func TestGuardRedactAndLimit(t *testing.T) {
+	var logged []llm.Intervention
+	fake := llm.NewFake(llm.ReplyText("ok"))
+	client := fake.Client()
+	llm.WithGuardLogger(func(i llm.Intervention) { logged = append(logged, i) })(client)
+	client.Use(llm.Redact(nil), llm.MaxPromptTokens(50))
+
+	_, err := client.CompletionByParams(llm.UserMessage("key sk-abcdefghijklmnopqrstuv, mail me at bob@example.com, price 67123.45 at 1700000000000"))
+	if err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+	body := string(fake.Requests()[0].Body)
+	if strings.Contains(body, "sk-abc") || strings.Contains(body, "bob@") {
+		t.Errorf("Secrets leaked: %s", body)
+	}
+	if !strings.Contains(body, "[REDACTED:api_key]") || !strings.Contains(body, "67123.45 at 1700000000000") {
+		t.Errorf("Unexpected redaction: %s", body)
+	}
+	if len(logged) != 1 || logged[0].Action != "modified" || logged[0].Detail != "redacted api_key x1, email x1" {
+		t.Errorf("Unexpected interventions: %+v", logged)
+	}
+
+	_, err = client.CompletionByParams(llm.UserMessage(strings.Repeat("long prompt ", 100)))
+	if !errors.Is(err, llm.ErrBlocked) || len(fake.Requests()) != 1 {
+		t.Errorf("Expected oversized prompt to be blocked before sending, got %v", err)
+	}
+}
+
+func TestGuardRedactToolCalls(t *testing.T) {
+	fake := llm.NewFake(llm.ReplyText("ok"))
+	client := fake.Client()
+	llm.WithGuardLogger(func(llm.Intervention) {})(client)
+	client.Use(llm.Redact(nil))
+
+	_, err := client.CompletionByParams(
+		llm.UserMessage("notify me"),
+		llm.AssistantMessage("", llm.ToolCall{ID: "c1", Name: "send_mail", Arguments: `{"to":"bob@example.com"}`}),
+		llm.ToolMessage("sent with key sk-abcdefghijklmnopqrstuv", "c1"),
+	)
+	if err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+	body := string(fake.Requests()[0].Body)
+	if strings.Contains(body, "bob@") || strings.Contains(body, "sk-abc") {
+		t.Errorf("Secrets in tool calls or results leaked: %s", body)
+	}
+	if !strings.Contains(body, `[REDACTED:email]`) || !strings.Contains(body, "[REDACTED:api_key]") {
+		t.Errorf("Expected tool arguments and results to be redacted: %s", body)
+	}
+}
+
+func TestGuardOutputRules(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []string{"action"},
+		"properties": map[string]any{
+			"action": map[string]any{"type": "string", "enum": []any{"buy", "sell", "hold"}},
+		},
+	}
+	fake := llm.NewFake(
+		llm.ReplyText("Decision:\n```json\n{\"action\":\"buy\"}\n```"),
+		llm.ReplyText(`{"action":"moon"}`),
+		llm.ReplyToolCalls(llm.ToolCall{ID: "c1", Name: "futures_buy_market", Arguments: `{"symbol":"BTCUSDT","quantity":"5"}`}),
+		llm.ReplyText("I guarantee profit"),
+	)
+	client := fake.Client()
+	llm.WithGuardLogger(func(llm.Intervention) {})(client)
+	client.Use(
+		llm.OutputSchema(schema, true),
+	)
+
+	msg, err := client.CompletionByParams(llm.UserMessage("decide"))
+	if err != nil || msg.Content != `{"action":"buy"}` {
+		t.Fatalf("Expected repaired JSON, got %q (%v)", msg.Content, err)
+	}
+	if _, err := client.CompletionByParams(llm.UserMessage("decide")); !errors.Is(err, llm.ErrBlocked) {
+		t.Errorf("Expected enum violation to be blocked, got %v", err)
+	}
+
+	tools := fake.Client()
+	llm.WithGuardLogger(func(llm.Intervention) {})(tools)
+	tools.Use(
+		llm.ToolArgRange("futures_buy_market", "quantity", 0, 0.01, true),
+		llm.RejectPattern(regexp.MustCompile(`(?i)guarantee`)),
+	)
+	msg, err = tools.CompletionByParams(llm.UserMessage("trade"))
+	if err != nil || msg.ToolCalls[0].Function.Arguments != `{"quantity":"0.01","symbol":"BTCUSDT"}` {
+		t.Fatalf("Expected clamped quantity, got %+v (%v)", msg.ToolCalls, err)
+	}
+	if _, err := tools.CompletionByParams(llm.UserMessage("trade")); !errors.Is(err, llm.ErrBlocked) {
+		t.Errorf("Expected rejected pattern to be blocked, got %v", err)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"qty":  map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+			"tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	cases := map[string]bool{
+		`{"qty":0.5,"tags":["a"]}`: true,
+		`{"qty":2}`:                false,
+		`{"tags":[1]}`:             false,
+		`[1]`:                      false,
+	}
+	for input, valid := range cases {
+		v, _ := llm.ParseJSON[any](input)
+		if err := llm.ValidateSchema(v, schema); (err == nil) != valid {
+			t.Errorf("%s: expected valid=%v, got %v", input, valid, err)
+		}
+	}
+}
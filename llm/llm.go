@@ -2,6 +2,8 @@ package llm
 
 import (
 	"image"
+	"io"
+	"net/http"
 
 	_ "github.com/Cai-ki/cage/config"
 	"github.com/openai/openai-go"
@@ -11,8 +13,24 @@ import (
 var defaultClient *LLMClient
 
 type LLMClient struct {
-	cfg    *Config
-	openai *openai.Client
+	cfg        *Config
+	openai     *openai.Client
+	provider   Provider
+	transport  http.RoundTripper
+	embedCache EmbeddingCache
+	respCache  ResponseCache
+	guards     []Guard
+	guardLog   func(Intervention)
+}
+
+// ClientOption configures an LLMClient.
+type ClientOption func(*LLMClient)
+
+// WithTransport sends all API requests through rt, e.g. a Recorder or a Fake.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *LLMClient) {
+		c.transport = rt
+	}
 }
 
 func init() {
@@ -21,10 +39,23 @@ func init() {
 		// Delay error to first call
 		return
 	}
-	defaultClient, _ = newClient(cfg) // Error handling is done later
+	defaultClient, _ = NewClient(cfg) // Error handling is done later
 }
 
-func newClient(cfg *Config) (*LLMClient, error) {
+// NewClient creates a client for the given configuration. Most callers use the
+// package-level functions, which share a client built from the environment.
+// When Config.RecordMode is set and no transport is given, requests go
+// through a Recorder using Config.FixtureDir. Config.Provider selects the
+// chat and embedding backend, and Config.Cache enables the response cache.
+func NewClient(cfg *Config, opts ...ClientOption) (*LLMClient, error) {
+	c := &LLMClient{cfg: cfg}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.transport == nil && cfg.RecordMode != "" {
+		c.transport = NewRecorder(cfg.FixtureDir, RecordMode(cfg.RecordMode), nil)
+	}
+
 	// Create client using the new openai-go pattern
 	clientOptions := []option.RequestOption{
 		option.WithAPIKey(cfg.APIKey),
@@ -33,13 +64,33 @@ func newClient(cfg *Config) (*LLMClient, error) {
 	if cfg.BaseURL != "" {
 		clientOptions = append(clientOptions, option.WithBaseURL(cfg.BaseURL))
 	}
+	var httpClient *http.Client
+	if c.transport != nil {
+		httpClient = &http.Client{Transport: c.transport}
+		clientOptions = append(clientOptions, option.WithHTTPClient(httpClient))
+	}
 
 	client := openai.NewClient(clientOptions...)
+	c.openai = &client
 
-	return &LLMClient{
-		cfg:    cfg,
-		openai: &client,
-	}, nil
+	if c.respCache == nil {
+		c.respCache = newResponseCache(cfg)
+	}
+	if c.provider == nil {
+		provider, err := newProvider(cfg, c.openai, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		c.provider = provider
+	}
+
+	return c, nil
+}
+
+// SetDefaultClient replaces the client used by the package-level functions,
+// e.g. with a Fake in unit tests.
+func SetDefaultClient(c *LLMClient) {
+	defaultClient = c
 }
 
 func initDefaultClient() error {
@@ -49,7 +100,7 @@ func initDefaultClient() error {
 			return err
 		}
 		var newErr error
-		defaultClient, newErr = newClient(cfg)
+		defaultClient, newErr = NewClient(cfg)
 		if newErr != nil {
 			return newErr
 		}
@@ -58,6 +109,17 @@ func initDefaultClient() error {
 	return nil
 }
 
+// clientOrDefault returns c, or the default client when c is nil.
+func clientOrDefault(c *LLMClient) (*LLMClient, error) {
+	if c != nil {
+		return c, nil
+	}
+	if err := initDefaultClient(); err != nil {
+		return nil, err
+	}
+	return defaultClient, nil
+}
+
 // Completion generates text from a text prompt.
 func Completion(prompt string) (string, error) {
 	err := initDefaultClient()
@@ -65,7 +127,7 @@ func Completion(prompt string) (string, error) {
 		return "", err
 	}
 
-	return defaultClient.completion(prompt)
+	return defaultClient.Completion(prompt)
 }
 
 // Completion generates text from a text prompt.
@@ -75,7 +137,7 @@ func CompletionBySystem(prompt string) (string, error) {
 		return "", err
 	}
 
-	return defaultClient.completionBySystem(prompt)
+	return defaultClient.CompletionBySystem(prompt)
 }
 
 func CompletionByParams(args ...AllowedParam) (openai.ChatCompletionMessage, error) {
@@ -84,7 +146,7 @@ func CompletionByParams(args ...AllowedParam) (openai.ChatCompletionMessage, err
 		return openai.ChatCompletionMessage{}, err
 	}
 
-	return defaultClient.completionByParams(args...)
+	return defaultClient.CompletionByParams(args...)
 }
 
 // Vision analyzes an image and returns a textual description.
@@ -95,7 +157,7 @@ func Vision(img image.Image) (string, error) {
 		return "", err
 	}
 
-	return defaultClient.vision(img)
+	return defaultClient.Vision(img)
 }
 
 // VisionWithPrompt analyzes an image with a custom instruction.
@@ -105,7 +167,18 @@ func VisionWithPrompt(img image.Image, prompt string) (string, error) {
 		return "", err
 	}
 
-	return defaultClient.visionWithPrompt(img, prompt)
+	return defaultClient.VisionWithPrompt(img, prompt)
+}
+
+// VisionWithParts sends several images (in memory, files or URLs) mixed with
+// text in one request, e.g. charts of multiple timeframes.
+func VisionWithParts(parts ...ContentPart) (string, error) {
+	err := initDefaultClient()
+	if err != nil {
+		return "", err
+	}
+
+	return defaultClient.VisionWithParts(parts...)
 }
 
 // Embedding returns a vector representation of the input text.
@@ -115,7 +188,7 @@ func Embedding(text string) ([]float32, error) {
 		return nil, err
 	}
 
-	return defaultClient.embedding(text)
+	return defaultClient.Embedding(text)
 }
 
 // EmbeddingWithDim returns embedding vector with specified dimension.
@@ -125,8 +198,67 @@ func EmbeddingWithDim(text string, dimensions int) ([]float32, error) {
 		return nil, err
 	}
 
-	return defaultClient.embeddingWithDim(text, dimensions)
+	return defaultClient.EmbeddingWithDim(text, dimensions)
+}
+
+// EmbeddingBatch returns vectors for many texts, batching requests and
+// reusing cached vectors when a cache is set.
+func EmbeddingBatch(texts []string) ([][]float32, error) {
+	err := initDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return defaultClient.EmbeddingBatch(texts)
 }
 
-// func Transcribe(audio io.Reader) (string, error)
-// func TranscribeWithPrompt(audio io.Reader, prompt string) (string, error)
+// SetEmbeddingCache sets the embedding cache of the default client.
+func SetEmbeddingCache(cache EmbeddingCache) error {
+	err := initDefaultClient()
+	if err != nil {
+		return err
+	}
+
+	defaultClient.SetEmbeddingCache(cache)
+	return nil
+}
+
+// Transcribe converts speech to text, e.g. the WAV stream from media.RecordAudio.
+func Transcribe(audio io.Reader) (string, error) {
+	err := initDefaultClient()
+	if err != nil {
+		return "", err
+	}
+
+	return defaultClient.Transcribe(audio)
+}
+
+// TranscribeWithPrompt converts speech to text, guided by a prompt.
+func TranscribeWithPrompt(audio io.Reader, prompt string) (string, error) {
+	err := initDefaultClient()
+	if err != nil {
+		return "", err
+	}
+
+	return defaultClient.TranscribeWithPrompt(audio, prompt)
+}
+
+// TranscribeWithOptions converts speech to text with language, prompt or timestamp options.
+func TranscribeWithOptions(audio io.Reader, opts ...TranscribeOption) (*Transcript, error) {
+	err := initDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return defaultClient.TranscribeWithOptions(audio, opts...)
+}
+
+// Speech synthesizes text to audio. The caller must close the returned stream.
+func Speech(text string, opts ...SpeechOption) (io.ReadCloser, error) {
+	err := initDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return defaultClient.Speech(text, opts...)
+}
@@ -1,9 +1,14 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/openai/openai-go"
 )
@@ -11,14 +16,78 @@ import (
 // --- 1. MCPClient 结构体 ---
 
 type MCPClient struct {
-	tools map[string]*ToolExecutor
+	mu          sync.RWMutex
+	tools       map[string]*ToolExecutor
+	concurrency int // 同时执行的工具调用数上限
+
+	policies  map[string]*Policy // 工具权限策略，"*" 为默认策略
+	approver  Approver
+	approvals []ApprovalRecord
+
+	middlewares []Middleware
+	dryRun      map[string]bool // 演练模式的工具，"*" 表示全部
+}
+
+// ClientOption MCPClient 的可选配置
+type ClientOption func(*MCPClient)
+
+// DefaultConcurrency 默认的工具并发上限
+const DefaultConcurrency = 8
+
+// WithConcurrency 设置同一批 ToolCalls 的并发上限，n <= 1 表示顺序执行
+func WithConcurrency(n int) ClientOption {
+	return func(c *MCPClient) {
+		c.concurrency = n
+	}
 }
 
 // ToolExecutor 用于存储工具的元信息和执行函数
 type ToolExecutor struct {
-	Name     string
-	Func     interface{} // func(args ArgsStruct) (interface{}, error)
-	ArgsType interface{} // ArgsStruct 零值
+	Name        string
+	Description string                 // 工具描述，提供给模型
+	Func        interface{}            // func(args ArgsStruct) (interface{}, error) 或 Register 注册的泛型函数
+	ArgsType    interface{}            // ArgsStruct 零值
+	Schema      map[string]interface{} // 参数 JSON Schema，默认由 ArgsType 反射生成
+	Timeout     time.Duration          // 单次调用超时，0 表示不限制
+	SideEffects bool                   // 有副作用（如下单）的工具超时后仍等待调用结束并返回真实结果
+
+	// invoke 解析参数并调用工具，RegisterTool 通过反射实现，Register 为强类型实现
+	invoke func(ctx context.Context, arguments string) (interface{}, error)
+}
+
+var errBadSignature = errors.New("tool function must return (interface{}, error)")
+
+// ToolOption 注册工具时的可选配置
+type ToolOption func(*ToolExecutor)
+
+// WithDescription 设置工具描述
+func WithDescription(desc string) ToolOption {
+	return func(e *ToolExecutor) {
+		e.Description = desc
+	}
+}
+
+// WithTimeout 设置单次调用超时，工具通过 context 感知
+// 忽略 context 的工具超时后直接返回错误，工具本身仍在后台运行，有副作用的工具应同时使用 WithSideEffects
+func WithTimeout(d time.Duration) ToolOption {
+	return func(e *ToolExecutor) {
+		e.Timeout = d
+	}
+}
+
+// WithSideEffects 标记工具有副作用，超时只取消 context，仍等待调用结束并返回真实结果
+// 避免工具实际已执行（如订单已成交）而模型收到失败后重试
+func WithSideEffects() ToolOption {
+	return func(e *ToolExecutor) {
+		e.SideEffects = true
+	}
+}
+
+// WithSchema 使用手写的参数 JSON Schema 代替反射生成的结果
+func WithSchema(schema map[string]interface{}) ToolOption {
+	return func(e *ToolExecutor) {
+		e.Schema = schema
+	}
 }
 
 // --- 2. 全局默认客户端 ---
@@ -30,10 +99,35 @@ func init() {
 }
 
 // NewMCPClient 创建一个新的 MCPClient 实例
-func NewMCPClient() *MCPClient {
-	return &MCPClient{
-		tools: make(map[string]*ToolExecutor),
+func NewMCPClient(opts ...ClientOption) *MCPClient {
+	c := &MCPClient{
+		tools:       make(map[string]*ToolExecutor),
+		concurrency: DefaultConcurrency,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetConcurrency 修改工具并发上限
+func (c *MCPClient) SetConcurrency(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.concurrency = n
+}
+
+// lookup 按名称查找工具
+func (c *MCPClient) lookup(name string) (*ToolExecutor, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	executor, ok := c.tools[name]
+	return executor, ok
+}
+
+// Tool 按名称返回已注册的工具
+func (c *MCPClient) Tool(name string) (*ToolExecutor, bool) {
+	return c.lookup(name)
 }
 
 // --- 3. 注册工具的方法 ---
@@ -41,91 +135,197 @@ func NewMCPClient() *MCPClient {
 // RegisterTool 注册一个工具函数
 // fn 必须是 func(args ArgsStruct) (interface{}, error) 的形式
 // argsType 是 ArgsStruct 的零值
-func (c *MCPClient) RegisterTool(name string, fn interface{}, argsType interface{}) {
-	c.tools[name] = &ToolExecutor{
+func (c *MCPClient) RegisterTool(name string, fn interface{}, argsType interface{}, opts ...ToolOption) {
+	c.register(&ToolExecutor{
 		Name:     name,
 		Func:     fn,
 		ArgsType: argsType,
+		invoke: func(ctx context.Context, arguments string) (interface{}, error) {
+			return callReflect(name, fn, argsType, arguments)
+		},
+	}, opts)
+}
+
+func (c *MCPClient) register(executor *ToolExecutor, opts []ToolOption) {
+	for _, opt := range opts {
+		opt(executor)
+	}
+	if executor.Schema == nil {
+		executor.Schema = GenerateSchema(executor.ArgsType)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tools[executor.Name] = executor
+}
+
+// Register 以强类型方式注册工具，函数签名在编译期检查
+// fn 收到的 context 带有工具超时（见 WithTimeout），c 为 nil 时注册到默认客户端
+func Register[A, R any](c *MCPClient, name, desc string, fn func(context.Context, A) (R, error), opts ...ToolOption) {
+	if c == nil {
+		c = defaultClient
+	}
+	var zero A
+	c.register(&ToolExecutor{
+		Name:        name,
+		Description: desc,
+		Func:        fn,
+		ArgsType:    zero,
+		invoke: func(ctx context.Context, arguments string) (interface{}, error) {
+			var args A
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal arguments for tool %s: %w", name, err)
+			}
+			return fn(ctx, args)
+		},
+	}, opts)
+}
+
+// callReflect 兼容 RegisterTool 注册的 interface{} 函数
+func callReflect(name string, fn interface{}, argsType interface{}, arguments string) (interface{}, error) {
+	// 反序列化 arguments
+	argsValuePtr := reflect.New(reflect.TypeOf(argsType))
+	if err := json.Unmarshal([]byte(arguments), argsValuePtr.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments for tool %s: %w", name, err)
 	}
+
+	// 调用执行函数
+	fnResults := reflect.ValueOf(fn).Call([]reflect.Value{argsValuePtr.Elem()})
+
+	// 检查返回值
+	if len(fnResults) != 2 {
+		return nil, errBadSignature
+	}
+	result := fnResults[0].Interface()
+	errValue := fnResults[1]
+	if !errValue.IsNil() {
+		return result, errValue.Interface().(error)
+	}
+	return result, nil
 }
 
 // RegisterTool 全局函数，操作默认客户端
-func RegisterTool(name string, fn interface{}, argsType interface{}) {
-	defaultClient.RegisterTool(name, fn, argsType)
+func RegisterTool(name string, fn interface{}, argsType interface{}, opts ...ToolOption) {
+	defaultClient.RegisterTool(name, fn, argsType, opts...)
 }
 
 // --- 4. 执行工具调用的方法 ---
 
 // ExecuteToolCalls 接收 OpenAI 返回的 Message，自动解析并执行 ToolCalls
 func (c *MCPClient) ExecuteToolCalls(message openai.ChatCompletionMessage) ([]openai.ChatCompletionMessageParamUnion, error) {
-	var results []openai.ChatCompletionMessageParamUnion
+	return c.ExecuteToolCallsContext(context.Background(), message)
+}
 
+// ExecuteToolCallsContext 同 ExecuteToolCalls，每个工具收到的 context 派生自 ctx 并带有超时
+// 工具并发执行（上限见 WithConcurrency），结果顺序与 ToolCalls 一致
+// 未知工具、参数错误、超时和 panic 都会转换为该调用的错误消息，保证每个 tool_call_id 都有回复
+func (c *MCPClient) ExecuteToolCallsContext(ctx context.Context, message openai.ChatCompletionMessage) ([]openai.ChatCompletionMessageParamUnion, error) {
 	if message.ToolCalls == nil {
 		return nil, fmt.Errorf("message has no tool_calls")
 	}
 
-	for _, tc := range message.ToolCalls {
-		executor, ok := c.tools[tc.Function.Name]
-		if !ok {
-			return nil, fmt.Errorf("unknown tool: %s", tc.Function.Name)
-		}
+	c.mu.RLock()
+	limit := c.concurrency
+	c.mu.RUnlock()
+	if limit < 1 {
+		limit = 1
+	}
 
-		// 反序列化 arguments
-		argsValuePtr := reflect.New(reflect.TypeOf(executor.ArgsType))
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), argsValuePtr.Interface()); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal arguments for tool %s: %w", tc.Function.Name, err)
-		}
+	results := make([]openai.ChatCompletionMessageParamUnion, len(message.ToolCalls))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, tc := range message.ToolCalls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, tc openai.ChatCompletionMessageToolCall) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = toolMessage(tc.ID, c.executeOne(ctx, tc.Function.Name, tc.Function.Arguments))
+		}(i, tc)
+	}
+	wg.Wait()
 
-		// 调用执行函数
-		fn := reflect.ValueOf(executor.Func)
-		argsVal := argsValuePtr.Elem()
-		fnArgs := []reflect.Value{argsVal}
-		fnResults := fn.Call(fnArgs)
+	return results, nil
+}
 
-		// 检查返回值
-		if len(fnResults) != 2 {
-			return nil, fmt.Errorf("tool function must return (interface{}, error)")
-		}
-		result := fnResults[0].Interface()
-		errValue := fnResults[1]
-		var err error
-		if !errValue.IsNil() {
-			err = errValue.Interface().(error)
-		}
+// Call 执行一次工具调用并返回发给模型的内容，与 ExecuteToolCalls 一样经过中间件、权限策略和超时处理
+func (c *MCPClient) Call(ctx context.Context, name, arguments string) string {
+	return c.executeOne(ctx, name, arguments)
+}
 
-		toolCallID := tc.ID
-
-		if err != nil {
-			// 构造错误的 Tool Message
-			results = append(results, openai.ChatCompletionMessageParamUnion{
-				OfTool: &openai.ChatCompletionToolMessageParam{
-					Role: "tool",
-					Content: openai.ChatCompletionToolMessageParamContentUnion{
-						OfString: openai.String("Error: " + err.Error()),
-					},
-					ToolCallID: toolCallID,
-				},
-			})
-			continue
-		}
+// executeOne 执行单个调用并返回发给模型的内容
+func (c *MCPClient) executeOne(ctx context.Context, name, arguments string) string {
+	executor, ok := c.lookup(name)
+	if !ok {
+		return "Error: " + fmt.Sprintf("unknown tool: %s", name)
+	}
 
-		// 序列化结果并构造成功的 Tool Message
-		resultBytes, err := json.Marshal(result) // 处理错误
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal tool result for %s: %w", tc.Function.Name, err)
-		}
-		results = append(results, openai.ChatCompletionMessageParamUnion{
-			OfTool: &openai.ChatCompletionToolMessageParam{
-				Role: "tool",
-				Content: openai.ChatCompletionToolMessageParamContentUnion{
-					OfString: openai.String(string(resultBytes)),
-				},
-				ToolCallID: toolCallID,
+	result, err := c.invoke(ctx, executor, arguments)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+
+	// 序列化结果
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return "Error: " + fmt.Sprintf("failed to marshal tool result for %s: %v", name, err)
+	}
+	return string(resultBytes)
+}
+
+func toolMessage(toolCallID, content string) openai.ChatCompletionMessageParamUnion {
+	return openai.ChatCompletionMessageParamUnion{
+		OfTool: &openai.ChatCompletionToolMessageParam{
+			Role: "tool",
+			Content: openai.ChatCompletionToolMessageParamContentUnion{
+				OfString: openai.String(content),
 			},
-		})
+			ToolCallID: toolCallID,
+		},
 	}
+}
 
-	return results, nil
+// execute 先检查权限策略，再调用工具，并将 panic 转换为错误；dryRun 时通过策略后即返回
+// 设置了超时的工具忽略 context 时，超时后直接返回错误，不再等待其结束；有副作用的工具总是等待结束
+func (c *MCPClient) execute(ctx context.Context, executor *ToolExecutor, arguments string, dryRun bool) (interface{}, error) {
+	// 审批可能需要等待人工确认，不计入工具超时
+	if err := c.authorize(ctx, executor.Name, arguments); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return dryRunResult(executor.Name, arguments), nil
+	}
+
+	if executor.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, executor.Timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("tool %s panicked: %v", executor.Name, r)}
+			}
+		}()
+		result, err := executor.invoke(ctx, arguments)
+		done <- outcome{result, err}
+	}()
+
+	if executor.SideEffects {
+		o := <-done
+		return o.result, o.err
+	}
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("tool %s: %w", executor.Name, ctx.Err())
+	}
 }
 
 // ExecuteToolCalls 全局函数，操作默认客户端
@@ -136,15 +336,29 @@ func ExecuteToolCalls(message openai.ChatCompletionMessage) ([]openai.ChatComple
 // --- 5. 获取工具定义的方法 (用于传递给 OpenAI) ---
 
 // GetToolsDefinition 返回注册工具的 JSON Schema 定义，可用于 OpenAI Tools 参数
+// 结果按工具名排序，保证每次请求的工具列表一致
 func (c *MCPClient) GetToolsDefinition() ([]openai.ChatCompletionToolParam, error) {
-	// 这里需要一个机制将 Go 结构体转换为 JSON Schema
-	// 由于 Go 无法直接从类型推断 JSON Schema，你需要手动定义或使用反射库
-	// 为简化，这里返回一个空的实现，你需要根据实际需要实现
-	// 例如，可以为每个 ToolExecutor 添加一个 Schema 字段
-	// 或者使用如 github.com/invopop/jsonschema 等库来生成
-	// 由于这比较复杂，且与你的核心需求（执行）关系不大，这里先不实现
-	// 你可以选择在注册工具时同时提供 JSON Schema 定义
-	return nil, fmt.Errorf("GetToolsDefinition not implemented, please provide tools JSON manually or implement schema generation")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.tools))
+	for name := range c.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]openai.ChatCompletionToolParam, 0, len(names))
+	for _, name := range names {
+		executor := c.tools[name]
+		fn := openai.FunctionDefinitionParam{
+			Name:       name,
+			Parameters: openai.FunctionParameters(executor.Schema),
+		}
+		if executor.Description != "" {
+			fn.Description = openai.String(executor.Description)
+		}
+		tools = append(tools, openai.ChatCompletionToolParam{Function: fn})
+	}
+	return tools, nil
 }
 
 // GetToolsDefinition 全局函数
@@ -1,7 +1,11 @@
 package mcp
 
 import (
+	"context"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/openai/openai-go"
 )
@@ -161,13 +165,15 @@ func TestMCPClient_ExecuteToolCalls_UnknownTool(t *testing.T) {
 		},
 	}
 
-	_, err := client.ExecuteToolCalls(message)
-	if err == nil {
-		t.Fatal("Expected error for unknown tool, got nil")
+	// 未知工具不再使整批失败，而是作为该调用的错误消息返回
+	results, err := client.ExecuteToolCalls(message)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls failed: %v", err)
 	}
 
-	if err.Error() != "unknown tool: unknown_tool" {
-		t.Errorf("Expected error 'unknown tool: unknown_tool', got '%v'", err)
+	expected := "Error: unknown tool: unknown_tool"
+	if len(results) != 1 || results[0].OfTool.ToolCallID != "call_unknown" || results[0].OfTool.Content.OfString != openai.String(expected) {
+		t.Errorf("Expected tool message '%s', got %+v", expected, results)
 	}
 }
 
@@ -202,3 +208,119 @@ func TestGlobalFunctions(t *testing.T) {
 		t.Errorf("Expected global result '%s', got '%s'", expectedResult, results[0].OfTool.Content.OfString)
 	}
 }
+
+func TestRegister_Generic(t *testing.T) {
+	client := NewMCPClient()
+	Register(client, "add", "add two numbers", func(ctx context.Context, args AddArgs) (map[string]float64, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("Expected no deadline without WithTimeout")
+		}
+		return map[string]float64{"result": args.A + args.B}, nil
+	})
+	Register(client, "slow", "waits for the deadline", func(ctx context.Context, args struct{}) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, WithTimeout(10*time.Millisecond))
+
+	message := openai.ChatCompletionMessage{
+		ToolCalls: []openai.ChatCompletionMessageToolCall{
+			{ID: "call_1", Function: openai.ChatCompletionMessageToolCallFunction{Name: "add", Arguments: `{"a": 1, "b": 2}`}},
+			{ID: "call_2", Function: openai.ChatCompletionMessageToolCallFunction{Name: "slow", Arguments: `{}`}},
+		},
+	}
+	results, err := client.ExecuteToolCalls(message)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls failed: %v", err)
+	}
+	if results[0].OfTool.Content.OfString != openai.String(`{"result":3}`) {
+		t.Errorf("Unexpected add result: %v", results[0].OfTool.Content.OfString)
+	}
+	if !strings.HasSuffix(results[1].OfTool.Content.OfString.Value, "context deadline exceeded") {
+		t.Errorf("Expected timeout error, got %v", results[1].OfTool.Content.OfString)
+	}
+
+	tools, _ := client.GetToolsDefinition()
+	if tools[0].Function.Description != openai.String("add two numbers") {
+		t.Errorf("Description not registered: %+v", tools[0].Function)
+	}
+
+	message.ToolCalls = message.ToolCalls[:1]
+	message.ToolCalls[0].Function.Arguments = `{"a": "x"}`
+	results, err = client.ExecuteToolCalls(message)
+	if err != nil || !strings.HasPrefix(results[0].OfTool.Content.OfString.Value, "Error: failed to unmarshal arguments for tool add") {
+		t.Errorf("Expected bad arguments error message, got %v (%v)", results[0].OfTool.Content.OfString, err)
+	}
+}
+
+func TestMCPClient_ExecuteToolCalls_Isolation(t *testing.T) {
+	client := NewMCPClient(WithConcurrency(2))
+	var running, peak int32
+	Register(client, "sleep", "", func(ctx context.Context, args struct{}) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return "done", nil
+	})
+	Register(client, "panic", "", func(ctx context.Context, args struct{}) (string, error) {
+		panic("boom")
+	})
+	// 忽略 context 的工具也会在超时后返回
+	Register(client, "stuck", "", func(ctx context.Context, args struct{}) (string, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	}, WithTimeout(10*time.Millisecond))
+	// 有副作用的工具超时后仍等待结束并返回真实结果
+	Register(client, "order", "", func(ctx context.Context, args struct{}) (string, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "filled", nil
+	}, WithTimeout(10*time.Millisecond), WithSideEffects())
+
+	call := func(id, name, args string) openai.ChatCompletionMessageToolCall {
+		return openai.ChatCompletionMessageToolCall{ID: id, Function: openai.ChatCompletionMessageToolCallFunction{Name: name, Arguments: args}}
+	}
+	message := openai.ChatCompletionMessage{ToolCalls: []openai.ChatCompletionMessageToolCall{
+		call("c1", "sleep", `{}`),
+		call("c2", "panic", `{}`),
+		call("c3", "sleep", `{}`),
+		call("c4", "stuck", `{}`),
+		call("c5", "sleep", `not json`),
+		call("c6", "sleep", `{}`),
+		call("c7", "order", `{}`),
+	}}
+
+	start := time.Now()
+	results, err := client.ExecuteToolCalls(message)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls failed: %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Stuck tool should time out, took %v", time.Since(start))
+	}
+	if peak > 2 {
+		t.Errorf("Concurrency limit exceeded: %d", peak)
+	}
+
+	want := map[string]string{
+		"c1": `"done"`,
+		"c2": "Error: tool panic panicked: boom",
+		"c4": "Error: tool stuck: context deadline exceeded",
+		"c7": `"filled"`,
+	}
+	for i, r := range results {
+		if r.OfTool.ToolCallID != message.ToolCalls[i].ID {
+			t.Errorf("Result %d out of order: %s", i, r.OfTool.ToolCallID)
+		}
+		if w, ok := want[r.OfTool.ToolCallID]; ok && r.OfTool.Content.OfString.Value != w {
+			t.Errorf("%s: expected %q, got %q", r.OfTool.ToolCallID, w, r.OfTool.Content.OfString.Value)
+		}
+	}
+	if !strings.HasPrefix(results[4].OfTool.Content.OfString.Value, "Error: failed to unmarshal") {
+		t.Errorf("Expected bad arguments message, got %q", results[4].OfTool.Content.OfString.Value)
+	}
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WithConsolidation 每隔 interval 在后台将早于 olderThan 的记忆合并为摘要，调用 Close 停止
+func WithConsolidation(interval, olderThan time.Duration) Option {
+	return func(m *Store) {
+		m.interval = interval
+		m.olderThan = olderThan
+	}
+}
+
+// WithConsolidateBatch 每条摘要最多合并 n 条记忆，默认 20
+func WithConsolidateBatch(n int) Option {
+	return func(m *Store) {
+		m.batch = n
+	}
+}
+
+// WithErrorHandler 处理后台合并的错误，默认写入标准日志
+func WithErrorHandler(fn func(error)) Option {
+	return func(m *Store) {
+		m.onError = fn
+	}
+}
+
+// Consolidate 将早于 olderThan 的记忆按时间从旧到新分批合并为摘要，返回新生成的摘要
+// 摘要继承原记忆的标签并集和最高重要度，时间取最新一条原记忆的时间，原记忆在摘要保存后删除
+// 已有的摘要不会再次参与合并，否则每次合并都会把旧摘要并入新摘要，最终只剩一条
+// 不足两条的批次不合并；出错时已生成的摘要会保留，并返回错误
+func (m *Store) Consolidate(olderThan time.Duration) ([]Memory, error) {
+	m.merging.Lock()
+	defer m.merging.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	var old []Memory
+	for _, mem := range m.All() {
+		if !mem.Summary && mem.CreatedAt.Before(cutoff) {
+			old = append(old, mem)
+		}
+	}
+
+	batch := m.batch
+	if batch < 2 {
+		batch = 2
+	}
+	var summaries []Memory
+	for len(old) >= 2 {
+		n := min(batch, len(old))
+		group := old[:n]
+		old = old[n:]
+
+		summary, err := m.merge(group)
+		if err != nil {
+			return summaries, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// merge 生成一条摘要并删除原记忆
+func (m *Store) merge(group []Memory) (Memory, error) {
+	content, err := m.summarize(group)
+	if err != nil {
+		return Memory{}, err
+	}
+	summary := Memory{
+		Content:   strings.TrimSpace(content),
+		CreatedAt: group[len(group)-1].CreatedAt,
+		Summary:   true,
+	}
+	seen := map[string]bool{}
+	for _, mem := range group {
+		summary.Importance = max(summary.Importance, mem.Importance)
+		summary.Sources = append(summary.Sources, mem.ID)
+		for _, tag := range mem.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				summary.Tags = append(summary.Tags, tag)
+			}
+		}
+	}
+	if err := m.put(&summary); err != nil {
+		return Memory{}, err
+	}
+	for _, mem := range group {
+		m.Delete(mem.ID)
+	}
+	return summary, nil
+}
+
+func (m *Store) consolidateLoop() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if _, err := m.Consolidate(m.olderThan); err != nil {
+				m.onError(err)
+			}
+		}
+	}
+}
+
+// completionSummarizer 用文本补全接口实现 Summarizer
+func completionSummarizer(complete func(prompt string) (string, error)) Summarizer {
+	return func(memories []Memory) (string, error) {
+		var b strings.Builder
+		b.WriteString("以下是按时间排列的多条记忆。请将它们合并为一段简洁的摘要，保留关键事实、结论和经验教训，" +
+			"去掉重复和已经过时的内容。只输出摘要本身。\n\n")
+		for _, mem := range memories {
+			fmt.Fprintf(&b, "- [%s]", mem.CreatedAt.Format("2006-01-02 15:04"))
+			if len(mem.Tags) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(mem.Tags, ", "))
+			}
+			fmt.Fprintf(&b, " %s\n", mem.Content)
+		}
+		return complete(b.String())
+	}
+}
@@ -0,0 +1,338 @@
+// Package memory 为 agent 提供长期记忆：按时间保存多条带标签和重要度的记忆，
+// 通过 embedding 相似度加上时间衰减召回相关记忆，并定期调用 LLM 将旧记忆合并为摘要。
+// 记忆保存在 state.StateManager 中，可以直接使用 state 的持久化。
+// 每条记忆都带有 embedding 向量，数据量较大，建议用 WithState 传入单独的 StateManager，
+// 并按间隔（WithFlushInterval）而不是每次修改时保存。
+package memory
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Cai-ki/cage/llm"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+// DefaultNamespace 默认实例在 state 中使用的命名空间
+const DefaultNamespace = "memories"
+
+// Memory 单条记忆
+type Memory struct {
+	ID         string    `json:"id"`
+	Content    string    `json:"content"`
+	Tags       []string  `json:"tags,omitempty"`
+	Importance float64   `json:"importance"` // 0 到 1
+	CreatedAt  time.Time `json:"created_at"`
+	Embedding  []float32 `json:"embedding,omitempty"`
+	Summary    bool      `json:"summary,omitempty"` // 由多条记忆合并而来
+	Sources    []string  `json:"sources,omitempty"` // 合并前的记忆 ID
+}
+
+// HasTag 判断记忆是否带有任意一个标签
+func (m Memory) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		for _, t := range m.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Embedder 将文本转换为向量，返回顺序与输入一致
+type Embedder func(texts []string) ([][]float32, error)
+
+// Summarizer 将多条记忆合并为一段摘要
+type Summarizer func(memories []Memory) (string, error)
+
+// Store 长期记忆库
+type Store struct {
+	sm         *state.StateManager
+	embed      Embedder
+	summarize  Summarizer
+	halfLife   time.Duration
+	wSimilar   float64
+	wRecency   float64
+	wImportant float64
+
+	olderThan time.Duration
+	batch     int
+	onError   func(error)
+
+	interval time.Duration // 后台合并间隔，0 表示不合并
+	seq      atomic.Uint64
+	merging  sync.Mutex // 串行化合并
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+var (
+	instance *Store
+	once     sync.Once
+)
+
+func init() {
+	// 通过 state 持久化后恢复为 Memory 而不是 map
+	state.RegisterType[Memory]()
+}
+
+// GetInstance 返回默认实例，记忆保存在 state 默认实例的 DefaultNamespace 命名空间下
+func GetInstance() *Store {
+	once.Do(func() {
+		instance = NewStore()
+	})
+	return instance
+}
+
+// NewStore 创建记忆库，默认使用 llm 包的默认客户端计算 embedding 和生成摘要
+// 使用 WithConsolidation 时，不再使用后应调用 Close 停止后台合并
+func NewStore(opts ...Option) *Store {
+	m := &Store{
+		embed:      llm.EmbeddingBatch,
+		summarize:  completionSummarizer(llm.Completion),
+		halfLife:   24 * time.Hour,
+		wSimilar:   1,
+		wRecency:   0.3,
+		wImportant: 0.2,
+		batch:      20,
+		onError:    func(err error) { log.Printf("memory: consolidate failed: %v", err) },
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.sm == nil {
+		m.sm = state.GetInstance().Namespace(DefaultNamespace)
+	}
+	if m.interval > 0 {
+		go m.consolidateLoop()
+	}
+	return m
+}
+
+// Close 停止后台合并，可重复调用
+func (m *Store) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Option NewStore 的可选配置
+type Option func(*Store)
+
+// WithState 记忆保存在 sm 中，默认为 state 默认实例的 DefaultNamespace 命名空间
+func WithState(sm *state.StateManager) Option {
+	return func(m *Store) {
+		m.sm = sm
+	}
+}
+
+// WithClient 使用指定的 LLM 客户端计算 embedding 和生成摘要
+func WithClient(c *llm.LLMClient) Option {
+	return func(m *Store) {
+		m.embed = c.EmbeddingBatch
+		m.summarize = completionSummarizer(c.Completion)
+	}
+}
+
+// WithEmbedder 自定义 embedding 计算
+func WithEmbedder(fn Embedder) Option {
+	return func(m *Store) {
+		m.embed = fn
+	}
+}
+
+// WithSummarizer 自定义摘要生成
+func WithSummarizer(fn Summarizer) Option {
+	return func(m *Store) {
+		m.summarize = fn
+	}
+}
+
+// WithHalfLife 设置时间衰减的半衰期，默认 24 小时，0 表示不按时间衰减
+func WithHalfLife(d time.Duration) Option {
+	return func(m *Store) {
+		m.halfLife = d
+	}
+}
+
+// WithWeights 设置召回得分中相似度、时间衰减和重要度的权重，默认 1、0.3、0.2
+func WithWeights(similarity, recency, importance float64) Option {
+	return func(m *Store) {
+		m.wSimilar, m.wRecency, m.wImportant = similarity, recency, importance
+	}
+}
+
+// --- 写入 ---
+
+// AddOption Add 的可选配置
+type AddOption func(*Memory)
+
+// WithTags 设置记忆的标签
+func WithTags(tags ...string) AddOption {
+	return func(mem *Memory) {
+		mem.Tags = append(mem.Tags, tags...)
+	}
+}
+
+// WithImportance 设置重要度，超出 0 到 1 的值会被截断，默认 0.5
+func WithImportance(importance float64) AddOption {
+	return func(mem *Memory) {
+		mem.Importance = math.Max(0, math.Min(1, importance))
+	}
+}
+
+// WithTime 设置记忆的时间，默认为当前时间，用于导入历史记录
+func WithTime(t time.Time) AddOption {
+	return func(mem *Memory) {
+		mem.CreatedAt = t
+	}
+}
+
+// Add 保存一条记忆，计算 embedding 失败时不会保存
+func (m *Store) Add(content string, opts ...AddOption) (Memory, error) {
+	mem := Memory{Content: content, Importance: 0.5, CreatedAt: time.Now()}
+	for _, opt := range opts {
+		opt(&mem)
+	}
+	if err := m.put(&mem); err != nil {
+		return Memory{}, err
+	}
+	return mem, nil
+}
+
+// put 计算 embedding 并写入 state
+func (m *Store) put(mem *Memory) error {
+	vecs, err := m.embed([]string{mem.Content})
+	if err != nil {
+		return err
+	}
+	if len(vecs) != 1 {
+		return errors.New("memory: embedder returned no vector")
+	}
+	mem.Embedding = vecs[0]
+	mem.ID = strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(m.seq.Add(1), 36)
+	m.sm.Set(mem.ID, *mem)
+	return nil
+}
+
+// Get 按 ID 获取记忆
+func (m *Store) Get(id string) (Memory, bool) {
+	return state.Get[Memory](m.sm, id)
+}
+
+// Delete 删除记忆
+func (m *Store) Delete(id string) {
+	m.sm.Delete(id)
+}
+
+// All 按时间从旧到新返回所有记忆
+func (m *Store) All() []Memory {
+	var memories []Memory
+	for _, value := range m.sm.GetAll() {
+		if mem, ok := value.(Memory); ok {
+			memories = append(memories, mem)
+		}
+	}
+	sort.Slice(memories, func(i, j int) bool {
+		if !memories[i].CreatedAt.Equal(memories[j].CreatedAt) {
+			return memories[i].CreatedAt.Before(memories[j].CreatedAt)
+		}
+		return memories[i].ID < memories[j].ID
+	})
+	return memories
+}
+
+// Len 返回记忆条数
+func (m *Store) Len() int {
+	return len(m.All())
+}
+
+// --- 召回 ---
+
+// Recalled 召回结果，Score 为相似度、时间衰减和重要度的加权和
+type Recalled struct {
+	Memory
+	Score      float64 `json:"score"`
+	Similarity float64 `json:"similarity"`
+	Recency    float64 `json:"recency"` // 0 到 1，每经过一个半衰期减半
+}
+
+// RecallOption Recall 的可选配置
+type RecallOption func(*recallConfig)
+
+type recallConfig struct {
+	tags     []string
+	minScore float64
+	now      time.Time
+}
+
+// WithTagFilter 只召回带有任意一个标签的记忆
+func WithTagFilter(tags ...string) RecallOption {
+	return func(cfg *recallConfig) {
+		cfg.tags = tags
+	}
+}
+
+// WithMinScore 丢弃得分低于 score 的记忆
+func WithMinScore(score float64) RecallOption {
+	return func(cfg *recallConfig) {
+		cfg.minScore = score
+	}
+}
+
+// Recall 返回与 query 最相关的 k 条记忆，得分从高到低
+// query 为空时不计算相似度，只按时间和重要度排序；k 小于 0 时返回全部
+func (m *Store) Recall(query string, k int, opts ...RecallOption) ([]Recalled, error) {
+	cfg := recallConfig{now: time.Now()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var queryVec []float32
+	if query != "" {
+		vecs, err := m.embed([]string{query})
+		if err != nil {
+			return nil, err
+		}
+		if len(vecs) != 1 {
+			return nil, errors.New("memory: embedder returned no vector")
+		}
+		queryVec = vecs[0]
+	}
+
+	var results []Recalled
+	for _, mem := range m.All() {
+		if len(cfg.tags) > 0 && !mem.HasTag(cfg.tags...) {
+			continue
+		}
+		r := Recalled{Memory: mem, Recency: m.recency(mem.CreatedAt, cfg.now)}
+		if queryVec != nil {
+			r.Similarity = float64(llm.CosineSimilarity(queryVec, mem.Embedding))
+		}
+		r.Score = m.wSimilar*r.Similarity + m.wRecency*r.Recency + m.wImportant*mem.Importance
+		if r.Score < cfg.minScore {
+			continue
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if k >= 0 && k < len(results) {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// recency 按半衰期计算时间衰减
+func (m *Store) recency(t, now time.Time) float64 {
+	age := now.Sub(t)
+	if age <= 0 || m.halfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(age) / float64(m.halfLife))
+}
@@ -0,0 +1,127 @@
+package memory_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm"
+	"github.com/Cai-ki/cage/llm/mcp/memory"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+// keywordEmbedder 按是否包含 BTC、ETH 生成二维向量
+func keywordEmbedder(texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := []float32{0.1, 0.1}
+		if strings.Contains(text, "BTC") {
+			vec[0] = 1
+		}
+		if strings.Contains(text, "ETH") {
+			vec[1] = 1
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+func TestStoreRecall(t *testing.T) {
+	store := memory.NewStore(memory.WithState(state.NewStateManager()), memory.WithEmbedder(keywordEmbedder))
+	now := time.Now()
+	store.Add("BTC broke 100k, took profit", memory.WithTags("BTCUSDT"), memory.WithTime(now.Add(-48*time.Hour)))
+	store.Add("ETH funding rate turned negative", memory.WithTags("ETHUSDT"), memory.WithTime(now.Add(-time.Hour)))
+	store.Add("BTC long stopped out, avoid chasing breakouts", memory.WithTags("BTCUSDT", "lesson"), memory.WithImportance(0.9))
+
+	results, err := store.Recall("BTC position", 2)
+	if err != nil {
+		t.Fatalf("Recall failed: %v", err)
+	}
+	if len(results) != 2 || !strings.Contains(results[0].Content, "stopped out") || !strings.Contains(results[1].Content, "100k") {
+		t.Fatalf("Expected recent BTC memory first, got %+v", results)
+	}
+	if results[0].Recency <= results[1].Recency || results[1].Recency > 0.3 {
+		t.Errorf("Expected recency to decay with age, got %v and %v", results[0].Recency, results[1].Recency)
+	}
+
+	results, _ = store.Recall("", -1, memory.WithTagFilter("ETHUSDT", "lesson"))
+	if len(results) != 2 || results[0].Similarity != 0 {
+		t.Errorf("Expected tag-filtered results without similarity, got %+v", results)
+	}
+
+	results, _ = store.Recall("ETH", -1, memory.WithMinScore(1))
+	if len(results) != 1 || !strings.Contains(results[0].Content, "ETH") {
+		t.Errorf("Expected only ETH memory above min score, got %+v", results)
+	}
+}
+
+func TestStoreConsolidate(t *testing.T) {
+	fake := llm.NewFake()
+	sm := state.NewStateManager()
+	store := memory.NewStore(memory.WithState(sm), memory.WithClient(fake.Client()))
+	vec := llm.FakeReply{Embeddings: [][]float32{{1, 0}}}
+
+	old := time.Now().Add(-48 * time.Hour)
+	fake.Push(vec, vec, vec)
+	store.Add("opened long at 95k", memory.WithTags("BTCUSDT"), memory.WithTime(old))
+	store.Add("closed long at 97k", memory.WithTags("BTCUSDT", "win"), memory.WithTime(old.Add(time.Hour)), memory.WithImportance(0.8))
+	store.Add("waiting for pullback")
+
+	fake.Push(llm.ReplyText(" Long 95k -> 97k was profitable. \n"), vec)
+	summaries, err := store.Consolidate(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Consolidate failed: %v", err)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("Expected one summary, got %+v", summaries)
+	}
+	summary := summaries[0]
+	if summary.Content != "Long 95k -> 97k was profitable." || !summary.Summary || len(summary.Sources) != 2 ||
+		summary.Importance != 0.8 || strings.Join(summary.Tags, ",") != "BTCUSDT,win" || !summary.CreatedAt.Equal(old.Add(time.Hour)) {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	requests := fake.Requests()
+	if prompt := string(requests[3].Body); !strings.Contains(prompt, "opened long at 95k") || strings.Contains(prompt, "pullback") {
+		t.Errorf("Expected only old memories in prompt, got %s", prompt)
+	}
+
+	all := store.All()
+	if len(all) != 2 || all[0].ID != summary.ID || all[1].Content != "waiting for pullback" {
+		t.Errorf("Expected summary and recent memory, got %+v", all)
+	}
+
+	// 通过 state 持久化后仍能恢复为 Memory
+	file := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	if err := sm.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	sm.Clear()
+	if err := sm.Restore(file); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := store.Get(summary.ID); !ok || got.Content != summary.Content || len(got.Embedding) != 2 {
+		t.Errorf("Expected restored summary, got %+v", got)
+	}
+
+	// 没有足够的旧记忆时不调用 LLM
+	if summaries, err := store.Consolidate(24 * time.Hour); err != nil || len(summaries) != 0 {
+		t.Errorf("Expected nothing to consolidate, got %+v, %v", summaries, err)
+	}
+
+	// 已有的摘要不会与新的旧记忆再次合并
+	fake.Push(vec, vec, llm.ReplyText("ETH chop, stayed flat"), vec)
+	store.Add("ETH ranging", memory.WithTime(old.Add(2*time.Hour)))
+	store.Add("no trade on ETH", memory.WithTime(old.Add(3*time.Hour)))
+	summaries, err = store.Consolidate(24 * time.Hour)
+	if err != nil || len(summaries) != 1 || len(summaries[0].Sources) != 2 {
+		t.Fatalf("Expected a new summary of the two new memories, got %+v, %v", summaries, err)
+	}
+	requests = fake.Requests()
+	if prompt := string(requests[len(requests)-2].Body); strings.Contains(prompt, "profitable") {
+		t.Errorf("Existing summary must not be merged again, got %s", prompt)
+	}
+	if _, ok := store.Get(summary.ID); !ok || store.Len() != 3 {
+		t.Errorf("Expected both summaries and the recent memory, got %+v", store.All())
+	}
+}
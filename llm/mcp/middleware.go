@@ -0,0 +1,173 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Cai-ki/cage/jsondb"
+)
+
+// Invocation 一次工具调用的上下文，After 执行时 Result、Err、Duration 已填好
+type Invocation struct {
+	Tool      string
+	Arguments string
+	Start     time.Time
+	Result    interface{}
+	Err       error
+	Duration  time.Duration
+	DryRun    bool // 为 true 时工具未真正执行
+}
+
+// Middleware 包裹每次工具调用的钩子，Before 和 After 均可为 nil
+// Before 返回错误时跳过执行，该错误作为调用结果返回；After 可以改写 Result 和 Err
+type Middleware struct {
+	Name   string
+	Before func(ctx context.Context, inv *Invocation) error
+	After  func(ctx context.Context, inv *Invocation)
+}
+
+// Use 追加中间件，按添加顺序执行 Before，逆序执行 After
+func (c *MCPClient) Use(middlewares ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+// Use 全局函数，操作默认客户端
+func Use(middlewares ...Middleware) {
+	defaultClient.Use(middlewares...)
+}
+
+// WithMiddleware 创建客户端时添加中间件
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *MCPClient) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithDryRun 开启演练模式：经过策略和中间件，但不真正执行工具
+// tools 为空时对所有工具生效，否则只对列出的工具生效，便于只拦截下单类工具做影子交易
+func WithDryRun(tools ...string) ClientOption {
+	return func(c *MCPClient) {
+		c.dryRun = dryRunSet(tools)
+	}
+}
+
+// SetDryRun 开启或关闭演练模式，tools 含义同 WithDryRun
+func (c *MCPClient) SetDryRun(enabled bool, tools ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !enabled {
+		c.dryRun = nil
+		return
+	}
+	c.dryRun = dryRunSet(tools)
+}
+
+// SetDryRun 全局函数，操作默认客户端
+func SetDryRun(enabled bool, tools ...string) {
+	defaultClient.SetDryRun(enabled, tools...)
+}
+
+func dryRunSet(tools []string) map[string]bool {
+	if len(tools) == 0 {
+		return map[string]bool{"*": true}
+	}
+	set := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		set[tool] = true
+	}
+	return set
+}
+
+// dryRunResult 演练模式下返回给模型的结果
+func dryRunResult(name, arguments string) map[string]interface{} {
+	return map[string]interface{}{
+		"dry_run":   true,
+		"tool":      name,
+		"arguments": argumentsJSON(arguments),
+		"message":   fmt.Sprintf("tool %s was not executed (dry run)", name),
+	}
+}
+
+// AuditEntry 审计日志中的一条工具调用记录
+type AuditEntry struct {
+	Tool       string          `json:"tool"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Result     interface{}     `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Start      time.Time       `json:"start"`
+	DurationMs float64         `json:"duration_ms"`
+	DryRun     bool            `json:"dry_run,omitempty"`
+}
+
+// AuditLog 将每次工具调用（包括被策略拒绝的调用）写入 jsondb，可用 db.GetLatest 等方法查询
+func AuditLog(db *jsondb.Database) Middleware {
+	return Middleware{
+		Name: "audit",
+		After: func(ctx context.Context, inv *Invocation) {
+			entry := AuditEntry{
+				Tool:       inv.Tool,
+				Arguments:  argumentsJSON(inv.Arguments),
+				Result:     inv.Result,
+				Start:      inv.Start,
+				DurationMs: float64(inv.Duration.Microseconds()) / 1000,
+				DryRun:     inv.DryRun,
+			}
+			if inv.Err != nil {
+				entry.Error = inv.Err.Error()
+			}
+			if err := db.Add(entry); err != nil {
+				// 结果无法序列化时只保留文本，避免丢失整条记录
+				entry.Result = fmt.Sprint(inv.Result)
+				if err = db.Add(entry); err != nil {
+					log.Printf("mcp: failed to write audit entry for %s: %v", inv.Tool, err)
+				}
+			}
+		},
+	}
+}
+
+// argumentsJSON 合法的 JSON 参数原样保留，否则作为字符串记录
+func argumentsJSON(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	data, _ := json.Marshal(arguments)
+	return data
+}
+
+// invoke 依次执行中间件、策略检查和工具本身，本地调用和 MCP 服务端都经过这里
+func (c *MCPClient) invoke(ctx context.Context, executor *ToolExecutor, arguments string) (interface{}, error) {
+	c.mu.RLock()
+	middlewares := c.middlewares
+	dryRun := c.dryRun["*"] || c.dryRun[executor.Name]
+	c.mu.RUnlock()
+
+	inv := &Invocation{Tool: executor.Name, Arguments: arguments, Start: time.Now(), DryRun: dryRun}
+	ran := 0
+	for _, mw := range middlewares {
+		ran++
+		if mw.Before == nil {
+			continue
+		}
+		if inv.Err = mw.Before(ctx, inv); inv.Err != nil {
+			break
+		}
+	}
+	if inv.Err == nil {
+		inv.Result, inv.Err = c.execute(ctx, executor, inv.Arguments, inv.DryRun)
+	}
+	inv.Duration = time.Since(inv.Start)
+
+	// 只有 Before 执行过的中间件才会执行 After
+	for i := ran - 1; i >= 0; i-- {
+		if after := middlewares[i].After; after != nil {
+			after(ctx, inv)
+		}
+	}
+	return inv.Result, inv.Err
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/jsondb"
+)
+
+func TestMiddleware_Order(t *testing.T) {
+	client, executed := newPolicyClient()
+	var trace []string
+	hook := func(name string) Middleware {
+		return Middleware{
+			Name: name,
+			Before: func(ctx context.Context, inv *Invocation) error {
+				trace = append(trace, "before "+name)
+				if strings.Contains(inv.Arguments, "blocked") {
+					return errors.New("blocked by " + name)
+				}
+				return nil
+			},
+			After: func(ctx context.Context, inv *Invocation) {
+				trace = append(trace, "after "+name)
+			},
+		}
+	}
+	client.Use(hook("a"), hook("b"))
+	executor, _ := client.lookup("buy")
+
+	if _, err := client.invoke(context.Background(), executor, `{}`); err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	want := []string{"before a", "before b", "after b", "after a"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("Expected %v, got %v", want, trace)
+	}
+
+	trace = nil
+	_, err := client.invoke(context.Background(), executor, `{"symbol":"blocked"}`)
+	if err == nil || err.Error() != "blocked by a" {
+		t.Errorf("Expected Before error, got %v", err)
+	}
+	if want := []string{"before a", "after a"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("Expected %v, got %v", want, trace)
+	}
+	if *executed != 1 {
+		t.Errorf("Blocked call must not execute, executed %d times", *executed)
+	}
+}
+
+func TestAuditLog_DryRun(t *testing.T) {
+	db, err := jsondb.NewDatabase(filepath.Join(t.TempDir(), "audit.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, executed := newPolicyClient()
+	client.Use(AuditLog(db))
+	client.SetPolicy("buy", MaxValue("quantity", 1))
+	client.SetDryRun(true, "buy")
+
+	buy, _ := client.lookup("buy")
+	balance, _ := client.lookup("balance")
+	result, err := client.invoke(context.Background(), buy, `{"symbol":"BTCUSDT","quantity":0.5}`)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if m, ok := result.(map[string]interface{}); !ok || m["dry_run"] != true {
+		t.Errorf("Expected dry run result, got %v", result)
+	}
+	// 演练模式仍然检查策略
+	if _, err := client.invoke(context.Background(), buy, `{"quantity":5}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected policy denial in dry run, got %v", err)
+	}
+	// 未列出的工具照常执行
+	if result, _ := client.invoke(context.Background(), balance, `{}`); result != "100" {
+		t.Errorf("Expected balance to execute, got %v", result)
+	}
+	if *executed != 0 {
+		t.Errorf("Dry run must not execute, executed %d times", *executed)
+	}
+
+	var entries []AuditEntry
+	if err := db.GetLatest(10, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d", len(entries))
+	}
+	if entries[0].Tool != "buy" || !entries[0].DryRun || string(entries[0].Arguments) != `{"symbol":"BTCUSDT","quantity":0.5}` {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if !strings.Contains(entries[1].Error, "exceeds max") {
+		t.Errorf("Expected denial to be audited: %+v", entries[1])
+	}
+	if entries[2].Tool != "balance" || entries[2].Result != "100" || entries[2].DryRun {
+		t.Errorf("Unexpected last entry: %+v", entries[2])
+	}
+
+	client.SetDryRun(false)
+	client.invoke(context.Background(), buy, `{"quantity":0.5}`)
+	if *executed != 1 {
+		t.Errorf("Expected execution after disabling dry run, got %d", *executed)
+	}
+}
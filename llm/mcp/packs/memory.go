@@ -0,0 +1,80 @@
+package packs
+
+import (
+	"context"
+
+	"github.com/Cai-ki/cage/llm/mcp"
+	"github.com/Cai-ki/cage/llm/mcp/memory"
+)
+
+type rememberArgs struct {
+	Content    string   `json:"content" desc:"需要长期记住的内容，例如结论、经验教训或重要事件"`
+	Tags       []string `json:"tags,omitempty" desc:"标签，例如交易对或类别，召回时可按标签过滤"`
+	Importance float64  `json:"importance,omitempty" desc:"重要度，0 到 1，不填时为 0.5" min:"0" max:"1"`
+}
+
+type recallArgs struct {
+	Query string   `json:"query" desc:"要回忆的内容，按语义相似度检索"`
+	Limit int      `json:"limit,omitempty" desc:"最多返回的条数，不填时为 5" min:"1" max:"50"`
+	Tags  []string `json:"tags,omitempty" desc:"只返回带有其中任意一个标签的记忆"`
+}
+
+type recalledMemory struct {
+	Content    string   `json:"content"`
+	Tags       []string `json:"tags,omitempty"`
+	Importance float64  `json:"importance"`
+	Time       string   `json:"time"`
+	Summary    bool     `json:"summary,omitempty"`
+	Score      float64  `json:"score"`
+}
+
+// RegisterMemoryTools 注册 remember、recall_memories 工具
+// 与 RegisterStateTools 的单条记忆不同，这里的记忆会长期保留，按语义和时间召回
+func RegisterMemoryTools(c *mcp.MCPClient, opts ...PackOption) {
+	cfg := newPackConfig(opts)
+	store := cfg.memories
+	if store == nil {
+		store = memory.GetInstance()
+	}
+
+	packRegister(c, cfg, "remember", "保存一条长期记忆，之后可以通过 recall_memories 按语义检索。",
+		func(ctx context.Context, args rememberArgs) (map[string]interface{}, error) {
+			opts := []memory.AddOption{memory.WithTags(args.Tags...)}
+			if args.Importance > 0 {
+				opts = append(opts, memory.WithImportance(args.Importance))
+			}
+			mem, err := store.Add(args.Content, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"id": mem.ID, "saved": true}, nil
+		})
+
+	packRegister(c, cfg, "recall_memories", "按语义检索最相关的长期记忆，越新、越重要的记忆排序越靠前。",
+		func(ctx context.Context, args recallArgs) ([]recalledMemory, error) {
+			limit := args.Limit
+			if limit <= 0 {
+				limit = 5
+			}
+			var opts []memory.RecallOption
+			if len(args.Tags) > 0 {
+				opts = append(opts, memory.WithTagFilter(args.Tags...))
+			}
+			results, err := store.Recall(args.Query, limit, opts...)
+			if err != nil {
+				return nil, err
+			}
+			memories := make([]recalledMemory, 0, len(results))
+			for _, r := range results {
+				memories = append(memories, recalledMemory{
+					Content:    r.Content,
+					Tags:       r.Tags,
+					Importance: r.Importance,
+					Time:       r.CreatedAt.Format("2006-01-02 15:04:05"),
+					Summary:    r.Summary,
+					Score:      r.Score,
+				})
+			}
+			return memories, nil
+		})
+}
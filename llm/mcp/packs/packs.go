@@ -0,0 +1,192 @@
+// Package packs 提供可以直接注册到 mcp.MCPClient 的内置工具包：
+// 合约行情和交易（quant）、记忆（state、memory）、告警通知（notify）和格式转换（helper）。
+// 工具包单独成包，只使用 mcp 核心功能时不会引入交易所客户端等依赖。
+package packs
+
+import (
+	"context"
+	"time"
+
+	"github.com/Cai-ki/cage/helper"
+	"github.com/Cai-ki/cage/llm/mcp"
+	"github.com/Cai-ki/cage/llm/mcp/memory"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+	"github.com/Cai-ki/cage/notify"
+	"github.com/Cai-ki/cage/quant"
+)
+
+// DefaultStateNamespace 状态工具包默认使用的命名空间，模型只能访问该命名空间下的键
+const DefaultStateNamespace = "agent"
+
+// PackOption 内置工具包的可选配置，与某个工具包无关的选项会被忽略
+type PackOption func(*packConfig)
+
+type packConfig struct {
+	prefix     string
+	only       map[string]bool
+	toolOpts   []mcp.ToolOption
+	trading    bool
+	indicators *quant.IndicatorConfig
+	state      *state.StateManager
+	memoryKey  string
+	memoryTTL  time.Duration
+	memories   *memory.Store
+	notifier   notify.Notifier
+}
+
+func newPackConfig(opts []PackOption) *packConfig {
+	cfg := &packConfig{memoryKey: "memory"}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.state == nil {
+		cfg.state = state.GetInstance().Namespace(DefaultStateNamespace)
+	}
+	return cfg
+}
+
+// WithPrefix 为工具包中的工具名加前缀，避免与已有工具重名
+func WithPrefix(prefix string) PackOption {
+	return func(cfg *packConfig) {
+		cfg.prefix = prefix
+	}
+}
+
+// WithTools 只注册工具包中列出的工具（名称不含前缀）
+func WithTools(names ...string) PackOption {
+	return func(cfg *packConfig) {
+		cfg.only = make(map[string]bool, len(names))
+		for _, name := range names {
+			cfg.only[name] = true
+		}
+	}
+}
+
+// WithPackToolOptions 对工具包中的每个工具应用 ToolOption，例如统一超时
+func WithPackToolOptions(opts ...mcp.ToolOption) PackOption {
+	return func(cfg *packConfig) {
+		cfg.toolOpts = append(cfg.toolOpts, opts...)
+	}
+}
+
+// WithTrading 量化工具包同时注册下单和平仓工具，默认只注册只读工具
+func WithTrading() PackOption {
+	return func(cfg *packConfig) {
+		cfg.trading = true
+	}
+}
+
+// WithIndicatorConfig 设置技术指标工具使用的指标配置
+func WithIndicatorConfig(config *quant.IndicatorConfig) PackOption {
+	return func(cfg *packConfig) {
+		cfg.indicators = config
+	}
+}
+
+// WithPackState 状态工具包使用的 StateManager，默认为全局实例的 DefaultStateNamespace 命名空间
+// 模型可以读写 sm 中的任意键，应传入专用的命名空间视图而不是根实例
+func WithPackState(sm *state.StateManager) PackOption {
+	return func(cfg *packConfig) {
+		cfg.state = sm
+	}
+}
+
+// WithMemory 设置未指定 key 时的记忆键和默认有效期，ttl 为 0 表示不过期
+func WithMemory(key string, ttl time.Duration) PackOption {
+	return func(cfg *packConfig) {
+		cfg.memoryKey = key
+		cfg.memoryTTL = ttl
+	}
+}
+
+// WithMemoryStore 长期记忆工具包使用的记忆库，默认为 memory.GetInstance()
+func WithMemoryStore(store *memory.Store) PackOption {
+	return func(cfg *packConfig) {
+		cfg.memories = store
+	}
+}
+
+// WithNotifier 通知工具包使用的通知渠道，默认为 notify.Send
+func WithNotifier(n notify.Notifier) PackOption {
+	return func(cfg *packConfig) {
+		cfg.notifier = n
+	}
+}
+
+// packRegister 按工具包配置注册单个工具，opts 在 WithPackToolOptions 之前应用
+func packRegister[A, R any](c *mcp.MCPClient, cfg *packConfig, name, desc string, fn func(context.Context, A) (R, error), opts ...mcp.ToolOption) {
+	if cfg.only != nil && !cfg.only[name] {
+		return
+	}
+	mcp.Register(c, cfg.prefix+name, desc, fn, append(opts, cfg.toolOpts...)...)
+}
+
+// --- notify 工具包 ---
+
+type sendAlertArgs struct {
+	Subject string `json:"subject" desc:"告警标题" max:"200"`
+	Message string `json:"message" desc:"告警正文"`
+}
+
+// RegisterNotifyTools 注册 send_alert 工具，让模型可以主动发送告警通知
+func RegisterNotifyTools(c *mcp.MCPClient, opts ...PackOption) {
+	cfg := newPackConfig(opts)
+	packRegister(c, cfg, "send_alert", "发送一条告警通知（如邮件），用于需要人工关注的重要事件。",
+		func(ctx context.Context, args sendAlertArgs) (map[string]interface{}, error) {
+			var err error
+			if cfg.notifier != nil {
+				err = cfg.notifier.Send(args.Subject, args.Message)
+			} else {
+				err = notify.Send(args.Subject, args.Message)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"sent": true}, nil
+		})
+}
+
+// --- helper 工具包 ---
+
+type convertArgs struct {
+	Input string `json:"input" desc:"待转换的原始内容"`
+}
+
+type describeArgs struct {
+	Description string `json:"description" desc:"自然语言描述"`
+}
+
+// RegisterHelperTools 注册 helper 包中的格式转换和脚本生成工具，这些工具内部会调用 LLM
+func RegisterHelperTools(c *mcp.MCPClient, opts ...PackOption) {
+	cfg := newPackConfig(opts)
+	converters := []struct {
+		name, desc string
+		fn         func(string) (string, error)
+	}{
+		{"json_to_sql", "根据 JSON 示例生成 SQL CREATE TABLE 语句。", helper.JsonToSql},
+		{"json_to_go_struct", "根据 JSON 示例生成 Go 结构体定义。", helper.JsonToGoStruct},
+		{"json_to_proto", "根据 JSON 示例生成 Protocol Buffers 消息定义。", helper.JsonToProto},
+		{"sql_to_json_schema", "将 SQL CREATE TABLE 语句转换为 JSON Schema。", helper.SqlToJSONSchema},
+		{"csv_to_sql", "根据 CSV 样例生成 SQL CREATE TABLE 语句。", helper.CsvToSql},
+	}
+	for _, conv := range converters {
+		fn := conv.fn
+		packRegister(c, cfg, conv.name, conv.desc, func(ctx context.Context, args convertArgs) (string, error) {
+			return fn(args.Input)
+		})
+	}
+
+	describers := []struct {
+		name, desc string
+		fn         func(string) (string, error)
+	}{
+		{"description_to_sql", "根据自然语言描述生成 SQL 表结构。", helper.DescriptionToSql},
+		{"describe_to_shell_script", "根据自然语言描述生成 shell 脚本（只生成，不执行）。", helper.DescribeToShellScript},
+	}
+	for _, d := range describers {
+		fn := d.fn
+		packRegister(c, cfg, d.name, d.desc, func(ctx context.Context, args describeArgs) (string, error) {
+			return fn(args.Description)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package packs_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp"
+	"github.com/Cai-ki/cage/llm/mcp/memory"
+	"github.com/Cai-ki/cage/llm/mcp/packs"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+func toolNames(c *mcp.MCPClient) []string {
+	var names []string
+	tools, _ := c.GetToolsDefinition()
+	for _, tool := range tools {
+		names = append(names, tool.Function.Name)
+	}
+	return names
+}
+
+func TestRegisterQuantTools(t *testing.T) {
+	client := mcp.NewMCPClient()
+	packs.RegisterQuantTools(client)
+	want := []string{"futures_get_balance", "futures_get_fee_rate", "futures_get_funding_rate", "futures_get_indicators",
+		"futures_get_klines", "futures_get_position", "futures_get_price"}
+	if got := toolNames(client); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected read-only tools %v, got %v", want, got)
+	}
+
+	client = mcp.NewMCPClient()
+	packs.RegisterQuantTools(client, packs.WithTrading(), packs.WithPrefix("binance_"), packs.WithTools("futures_buy_market", "futures_get_price"))
+	if got := toolNames(client); !reflect.DeepEqual(got, []string{"binance_futures_buy_market", "binance_futures_get_price"}) {
+		t.Errorf("Unexpected filtered tools: %v", got)
+	}
+	executor, _ := client.Tool("binance_futures_buy_market")
+	props := executor.Schema["properties"].(map[string]interface{})
+	if props["quantity"].(map[string]interface{})["minimum"] != 0.001 {
+		t.Errorf("Expected quantity schema with minimum, got %v", props["quantity"])
+	}
+	if executor.Description == "" {
+		t.Error("Expected description")
+	}
+	if !executor.SideEffects {
+		t.Error("Expected order tool to be marked with side effects")
+	}
+}
+
+func TestRegisterStateTools(t *testing.T) {
+	sm := state.NewStateManager().Namespace("BTCUSDT")
+
+	client := mcp.NewMCPClient()
+	packs.RegisterStateTools(client, packs.WithPackState(sm), packs.WithMemory("memory", time.Minute))
+	call := func(name, args string) map[string]interface{} {
+		t.Helper()
+		content := client.Call(context.Background(), name, args)
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(content), &result); err != nil {
+			t.Fatalf("%s returned %q", name, content)
+		}
+		return result
+	}
+
+	call("save_memory", `{"memory":"long BTC"}`)
+	call("save_memory", `{"memory":"short ETH","key":"eth","ttl_seconds":1}`)
+	if value, _ := sm.Get("memory"); value != "long BTC" {
+		t.Errorf("Expected default key to be used, got %v", value)
+	}
+	if got := call("save_memory", `{"memory":"add on dip","append":true}`); got["result"] != "long BTC\nadd on dip" {
+		t.Errorf("Expected appended memory, got %v", got["result"])
+	}
+	if got := call("get_memory", `{"key":"eth"}`); got["memory"] != "short ETH" || got["found"] != true {
+		t.Errorf("Unexpected get_memory result: %v", got)
+	}
+	if got := call("delete_memory", `{}`); got["deleted"] != true {
+		t.Errorf("Unexpected delete_memory result: %v", got)
+	}
+	if got := call("get_memory", `{}`); got["found"] != false {
+		t.Errorf("Expected memory to be deleted: %v", got)
+	}
+}
+
+func TestRegisterMemoryTools(t *testing.T) {
+	embed := func(texts []string) ([][]float32, error) {
+		vecs := make([][]float32, len(texts))
+		for i, text := range texts {
+			vecs[i] = []float32{0.1, 0.1}
+			if strings.Contains(text, "BTC") {
+				vecs[i][0] = 1
+			}
+		}
+		return vecs, nil
+	}
+	store := memory.NewStore(memory.WithState(state.NewStateManager()), memory.WithEmbedder(embed))
+
+	client := mcp.NewMCPClient()
+	packs.RegisterMemoryTools(client, packs.WithMemoryStore(store))
+	client.Call(context.Background(), "remember", `{"content":"BTC breakouts failed twice","tags":["BTCUSDT"],"importance":0.9}`)
+	client.Call(context.Background(), "remember", `{"content":"ETH range 3k-3.2k"}`)
+
+	content := client.Call(context.Background(), "recall_memories", `{"query":"BTC breakout","limit":1}`)
+	var results []map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &results); err != nil {
+		t.Fatalf("recall_memories returned %q", content)
+	}
+	if len(results) != 1 || results[0]["content"] != "BTC breakouts failed twice" || results[0]["importance"] != 0.9 {
+		t.Errorf("Unexpected recall result: %v", results)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 memories, got %d", store.Len())
+	}
+}
+
+func TestRegisterStateToolsDefaultNamespace(t *testing.T) {
+	root := state.GetInstance()
+	root.Set("secret", "api key")
+	defer root.Delete("secret")
+
+	client := mcp.NewMCPClient()
+	packs.RegisterStateTools(client)
+	client.Call(context.Background(), "save_memory", `{"memory":"hello","key":"secret"}`)
+	defer root.Namespace(packs.DefaultStateNamespace).Delete("secret")
+	client.Call(context.Background(), "delete_memory", `{"key":"secret"}`)
+
+	if value, _ := root.Get("secret"); value != "api key" {
+		t.Errorf("State tools must not touch keys outside their namespace, got %v", value)
+	}
+	if got := client.Call(context.Background(), "get_memory", `{"key":"../secret"}`); strings.Contains(got, "api key") {
+		t.Errorf("Expected namespace to be enforced, got %s", got)
+	}
+}
+
+type recordingNotifier struct {
+	subject, body string
+}
+
+func (n *recordingNotifier) Send(subject, body string) error {
+	n.subject, n.body = subject, body
+	return nil
+}
+
+func TestRegisterNotifyAndHelperTools(t *testing.T) {
+	client := mcp.NewMCPClient()
+	notifier := &recordingNotifier{}
+	packs.RegisterNotifyTools(client, packs.WithNotifier(notifier))
+	packs.RegisterHelperTools(client)
+
+	content := client.Call(context.Background(), "send_alert", `{"subject":"liquidation risk","message":"distance < 5%"}`)
+	if content != `{"sent":true}` || notifier.subject != "liquidation risk" || notifier.body != "distance < 5%" {
+		t.Errorf("Unexpected send_alert result %q, notifier %+v", content, notifier)
+	}
+
+	names := strings.Join(toolNames(client), ",")
+	for _, name := range []string{"json_to_sql", "json_to_go_struct", "csv_to_sql", "describe_to_shell_script"} {
+		if !strings.Contains(names, name) {
+			t.Errorf("Expected helper tool %s in %s", name, names)
+		}
+	}
+}
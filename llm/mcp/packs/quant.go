@@ -0,0 +1,153 @@
+package packs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp"
+	"github.com/Cai-ki/cage/quant"
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+// defaultIndicatorConfig 技术指标工具的默认配置，适合中频交易
+var defaultIndicatorConfig = &quant.IndicatorConfig{
+	EMAs:       []int{12, 26, 50},
+	MAs:        []int{20, 60},
+	RSI:        []int{14},
+	MACD:       true,
+	Stochastic: []int{14, 3},
+	ATR:        []int{14},
+	Bollinger:  []int{20, 2},
+}
+
+type symbolArgs struct {
+	Symbol string `json:"symbol" desc:"合约交易对符号，例如 'BTCUSDT'。"`
+}
+
+type klinesArgs struct {
+	Symbol   string `json:"symbol" desc:"合约交易对符号，例如 'BTCUSDT'。"`
+	Interval string `json:"interval" desc:"K线周期" enum:"1m,3m,5m,15m,30m,1h,2h,4h,6h,12h,1d,1w"`
+	Limit    int    `json:"limit,omitempty" desc:"K线数量，默认 100" min:"1" max:"500"`
+}
+
+type indicatorsArgs struct {
+	Symbol     string   `json:"symbol" desc:"合约交易对符号，例如 'BTCUSDT'。"`
+	Timeframes []string `json:"timeframes,omitempty" desc:"需要计算的周期，按从大到小排列，默认 [\"1h\",\"15m\",\"5m\"]" max:"6"`
+	Limit      int      `json:"limit,omitempty" desc:"每个周期使用的K线数量，默认 150" min:"60" max:"500"`
+}
+
+type balanceArgs struct {
+	Asset string `json:"asset,omitempty" desc:"资产名称，默认 USDT"`
+}
+
+type orderArgs struct {
+	Symbol   string  `json:"symbol" desc:"合约交易对符号，例如 'BTCUSDT'。"`
+	Quantity float64 `json:"quantity" desc:"下单数量（以合约单位计，如 BTC 数量）。" min:"0.001"`
+}
+
+// RegisterQuantTools 注册合约行情和账户工具：价格、K线、技术指标、余额、持仓、资金费率和手续费率
+// 使用 WithTrading 时额外注册 futures_buy_market、futures_sell_market、futures_close_position，
+// 这些工具会真实下单，建议配合 mcp.SetPolicy 限制数量和频率；它们标记了 WithSideEffects，超时后仍返回真实结果
+func RegisterQuantTools(c *mcp.MCPClient, opts ...PackOption) {
+	cfg := newPackConfig(opts)
+	indicators := cfg.indicators
+	if indicators == nil {
+		indicators = defaultIndicatorConfig
+	}
+
+	packRegister(c, cfg, "futures_get_price", "获取合约交易对当前的标记价格（用于估值和强平计算，不是最新成交价）。",
+		func(ctx context.Context, args symbolArgs) (map[string]interface{}, error) {
+			price, err := quant.FuturesGetTickerPrice(args.Symbol)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"symbol": args.Symbol, "price": price}, nil
+		})
+
+	packRegister(c, cfg, "futures_get_klines", "获取合约交易对的历史K线（开高低收量）。",
+		func(ctx context.Context, args klinesArgs) ([]*futures.Kline, error) {
+			if args.Limit <= 0 {
+				args.Limit = 100
+			}
+			return quant.FuturesGetKlines(args.Symbol, args.Interval, args.Limit)
+		})
+
+	packRegister(c, cfg, "futures_get_indicators", "计算多个周期的技术指标（EMA、MA、RSI、MACD、随机指标、ATR、布林带）。",
+		func(ctx context.Context, args indicatorsArgs) (string, error) {
+			if len(args.Timeframes) == 0 {
+				args.Timeframes = []string{"1h", "15m", "5m"}
+			}
+			if args.Limit <= 0 {
+				args.Limit = 150
+			}
+			data := make(map[string][]*futures.Kline, len(args.Timeframes))
+			for _, tf := range args.Timeframes {
+				klines, err := quant.FuturesGetKlines(args.Symbol, tf, args.Limit)
+				if err != nil {
+					return "", fmt.Errorf("failed to get %s klines: %w", tf, err)
+				}
+				data[tf] = klines
+			}
+			multi := quant.NewIndicatorCalculator(indicators).CalculateMultiTimeframe(args.Symbol, data)
+			return multi.ToSimpleString(args.Timeframes), nil
+		})
+
+	packRegister(c, cfg, "futures_get_balance", "获取合约账户中某个资产的钱包余额。",
+		func(ctx context.Context, args balanceArgs) (map[string]interface{}, error) {
+			if args.Asset == "" {
+				args.Asset = "USDT"
+			}
+			balance, err := quant.FuturesGetBalance(args.Asset)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"asset": args.Asset, "balance": balance}, nil
+		})
+
+	packRegister(c, cfg, "futures_get_position", "获取合约交易对的当前持仓（数量、开仓均价、未实现盈亏、杠杆、强平价格等）。",
+		func(ctx context.Context, args symbolArgs) (*futures.PositionRisk, error) {
+			return quant.FuturesGetPosition(args.Symbol)
+		})
+
+	packRegister(c, cfg, "futures_get_funding_rate", "获取合约交易对的当前资金费率和下次结算时间。",
+		func(ctx context.Context, args symbolArgs) (map[string]interface{}, error) {
+			rate, next, err := quant.FuturesGetCurrentFundingRate(args.Symbol)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"symbol":            args.Symbol,
+				"funding_rate":      rate,
+				"next_funding_time": time.UnixMilli(next).Format(time.RFC3339),
+			}, nil
+		})
+
+	packRegister(c, cfg, "futures_get_fee_rate", "获取合约交易对的挂单（Maker）和吃单（Taker）手续费率。",
+		func(ctx context.Context, args symbolArgs) (map[string]interface{}, error) {
+			maker, taker, err := quant.FuturesGetFeeRateForSymbol(args.Symbol)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"symbol": args.Symbol, "maker": maker, "taker": taker}, nil
+		})
+
+	if !cfg.trading {
+		return
+	}
+
+	packRegister(c, cfg, "futures_buy_market", "在合约市场使用市价单开立多头仓位或平仓空头仓位。",
+		func(ctx context.Context, args orderArgs) (*futures.CreateOrderResponse, error) {
+			return quant.FuturesBuyMarket(args.Symbol, args.Quantity)
+		}, mcp.WithSideEffects())
+
+	packRegister(c, cfg, "futures_sell_market", "在合约市场使用市价单开立空头仓位或平仓多头仓位。",
+		func(ctx context.Context, args orderArgs) (*futures.CreateOrderResponse, error) {
+			return quant.FuturesSellMarket(args.Symbol, args.Quantity)
+		}, mcp.WithSideEffects())
+
+	packRegister(c, cfg, "futures_close_position", "自动检测并平掉指定交易对的所有合约持仓（使用 ReduceOnly 模式）。",
+		func(ctx context.Context, args symbolArgs) (*futures.CreateOrderResponse, error) {
+			return quant.FuturesClosePosition(args.Symbol)
+		}, mcp.WithSideEffects())
+}
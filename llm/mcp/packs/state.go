@@ -0,0 +1,70 @@
+package packs
+
+import (
+	"context"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+type saveMemoryArgs struct {
+	Memory     string `json:"memory" desc:"需要保存的记忆内容"`
+	Key        string `json:"key,omitempty" desc:"记忆的键，不填时使用默认键"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty" desc:"有效期（秒），不填时使用默认有效期" min:"0"`
+	Append     bool   `json:"append,omitempty" desc:"为 true 时追加到已有记忆之后，而不是覆盖"`
+}
+
+type memoryKeyArgs struct {
+	Key string `json:"key,omitempty" desc:"记忆的键，不填时使用默认键"`
+}
+
+// RegisterStateTools 注册 save_memory、get_memory、delete_memory 工具
+// 记忆保存在 StateManager 的命名空间视图中（见 WithPackState），模型给出的 key 无法访问命名空间以外的状态
+func RegisterStateTools(c *mcp.MCPClient, opts ...PackOption) {
+	cfg := newPackConfig(opts)
+	key := func(k string) string {
+		if k == "" {
+			return cfg.memoryKey
+		}
+		return k
+	}
+
+	packRegister(c, cfg, "save_memory", "将需要持久化的记忆存储下来，记忆会传入下次调用时的上下文中。",
+		func(ctx context.Context, args saveMemoryArgs) (map[string]interface{}, error) {
+			ttl := cfg.memoryTTL
+			if args.TTLSeconds > 0 {
+				ttl = time.Duration(args.TTLSeconds) * time.Second
+			}
+			var options []state.StateOption
+			if ttl > 0 {
+				options = append(options, state.WithTTL(ttl))
+			}
+			memory := args.Memory
+			if args.Append {
+				// 并发调用时原子追加，不会丢失其他调用写入的内容
+				memory = state.Update(cfg.state, key(args.Key), func(old string, ok bool) string {
+					if ok && old != "" {
+						return old + "\n" + args.Memory
+					}
+					return args.Memory
+				}, options...)
+			} else {
+				cfg.state.Set(key(args.Key), memory, options...)
+			}
+			return map[string]interface{}{"key": key(args.Key), "result": memory}, nil
+		})
+
+	packRegister(c, cfg, "get_memory", "读取之前保存的记忆。",
+		func(ctx context.Context, args memoryKeyArgs) (map[string]interface{}, error) {
+			value, ok := cfg.state.Get(key(args.Key))
+			return map[string]interface{}{"key": key(args.Key), "found": ok, "memory": value}, nil
+		})
+
+	packRegister(c, cfg, "delete_memory", "删除之前保存的记忆。",
+		func(ctx context.Context, args memoryKeyArgs) (map[string]interface{}, error) {
+			existed := cfg.state.Exists(key(args.Key))
+			cfg.state.Delete(key(args.Key))
+			return map[string]interface{}{"key": key(args.Key), "deleted": existed}, nil
+		})
+}
@@ -0,0 +1,367 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPolicyDenied 工具调用被权限策略拒绝
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// Decision 策略对工具调用的基本处理方式
+type Decision int
+
+const (
+	Allow           Decision = iota // 直接执行
+	Deny                            // 拒绝执行
+	RequireApproval                 // 需要审批钩子确认后执行
+)
+
+// Policy 单个工具的权限策略
+type Policy struct {
+	Decision    Decision
+	Constraints []Constraint // 参数约束，任一不满足即拒绝
+	RateLimit   int          // 每个 RatePeriod 内最多调用次数，0 表示不限制
+	RatePeriod  time.Duration
+
+	mu    sync.Mutex
+	calls []time.Time // 窗口内的调用时间
+}
+
+// Constraint 检查解码后的参数，返回错误表示不满足
+// 参数名保持调用方发送的大小写，自定义约束应像工具解码时一样不区分大小写地查找
+type Constraint func(args map[string]interface{}) error
+
+// PolicyOption 构造策略的可选配置
+type PolicyOption func(*Policy)
+
+// DenyTool 拒绝调用该工具
+func DenyTool() PolicyOption {
+	return func(p *Policy) {
+		p.Decision = Deny
+	}
+}
+
+// NeedApproval 调用前需要审批
+func NeedApproval() PolicyOption {
+	return func(p *Policy) {
+		p.Decision = RequireApproval
+	}
+}
+
+// WithConstraint 添加自定义参数约束
+func WithConstraint(c Constraint) PolicyOption {
+	return func(p *Policy) {
+		p.Constraints = append(p.Constraints, c)
+	}
+}
+
+// MaxValue 数值参数 field 不得超过 max，例如限制下单数量
+// field 不区分大小写，与 encoding/json 解码到工具参数时一致；缺少该参数或不是数值时拒绝
+func MaxValue(field string, max float64) PolicyOption {
+	return WithConstraint(func(args map[string]interface{}) error {
+		v, err := numberArg(args, field)
+		if err != nil {
+			return err
+		}
+		if v > max {
+			return fmt.Errorf("%s=%v exceeds max %v", field, v, max)
+		}
+		return nil
+	})
+}
+
+// MinValue 数值参数 field 不得低于 min，缺少该参数或不是数值时拒绝
+func MinValue(field string, min float64) PolicyOption {
+	return WithConstraint(func(args map[string]interface{}) error {
+		v, err := numberArg(args, field)
+		if err != nil {
+			return err
+		}
+		if v < min {
+			return fmt.Errorf("%s=%v is below min %v", field, v, min)
+		}
+		return nil
+	})
+}
+
+// OneOf 参数 field 只能取给定的值，例如限定交易对
+func OneOf(field string, values ...string) PolicyOption {
+	return WithConstraint(func(args map[string]interface{}) error {
+		arg, ok := argValue(args, field)
+		if !ok {
+			return fmt.Errorf("missing argument %s", field)
+		}
+		v := fmt.Sprint(arg)
+		for _, allowed := range values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s=%v is not one of %v", field, v, values)
+	})
+}
+
+// RateLimit 限制每 period 内最多调用 n 次
+func RateLimit(n int, period time.Duration) PolicyOption {
+	return func(p *Policy) {
+		p.RateLimit = n
+		p.RatePeriod = period
+	}
+}
+
+// argValue 按 encoding/json 的规则不区分大小写地查找参数
+func argValue(args map[string]interface{}, field string) (interface{}, bool) {
+	if v, ok := args[field]; ok {
+		return v, true
+	}
+	for k, v := range args {
+		if strings.EqualFold(k, field) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func numberArg(args map[string]interface{}, field string) (float64, error) {
+	arg, ok := argValue(args, field)
+	if !ok {
+		return 0, fmt.Errorf("missing argument %s", field)
+	}
+	switch v := arg.(type) {
+	case float64:
+		return v, nil
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%s=%v is not a number", field, arg)
+}
+
+// checkArgKeys 拒绝只有大小写不同的重复参数，encoding/json 解码时无法确定工具实际收到哪一个
+func checkArgKeys(args map[string]interface{}) error {
+	seen := make(map[string]string, len(args))
+	for k := range args {
+		folded := strings.ToUpper(strings.ToLower(k))
+		if other, ok := seen[folded]; ok {
+			return fmt.Errorf("ambiguous arguments %s and %s", other, k)
+		}
+		seen[folded] = k
+	}
+	return nil
+}
+
+// allowCall 检查并记录一次调用是否在频率限制内
+func (p *Policy) allowCall(now time.Time) bool {
+	if p.RateLimit <= 0 {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.withinLimitLocked(now) {
+		return false
+	}
+	p.calls = append(p.calls, now)
+	return true
+}
+
+// withinLimit 只检查频率限制，不记录调用
+func (p *Policy) withinLimit(now time.Time) bool {
+	if p.RateLimit <= 0 {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.withinLimitLocked(now)
+}
+
+// withinLimitLocked 丢弃窗口外的调用记录并检查剩余次数，调用方必须持有 p.mu
+func (p *Policy) withinLimitLocked(now time.Time) bool {
+	window := p.calls[:0]
+	for _, t := range p.calls {
+		if now.Sub(t) < p.RatePeriod {
+			window = append(window, t)
+		}
+	}
+	p.calls = window
+	return len(p.calls) < p.RateLimit
+}
+
+// ApprovalRequest 提交给审批钩子的信息
+type ApprovalRequest struct {
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments"`
+}
+
+// Approval 审批结果
+type Approval struct {
+	Approved bool      `json:"approved"`
+	By       string    `json:"by"`               // 审批人
+	Reason   string    `json:"reason,omitempty"` // 说明，拒绝时会返回给模型
+	At       time.Time `json:"at"`
+}
+
+// ApprovalRecord 一次审批的完整记录
+type ApprovalRecord struct {
+	ApprovalRequest
+	Approval
+}
+
+// Approver 审批钩子，可以是命令行确认、Web 接口或通知后等待回复
+// 应在 ctx 取消时返回
+type Approver func(ctx context.Context, req ApprovalRequest) (Approval, error)
+
+// SetPolicy 为工具设置权限策略，tool 为 "*" 时作为未单独配置工具的默认策略
+func (c *MCPClient) SetPolicy(tool string, opts ...PolicyOption) {
+	p := &Policy{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policies == nil {
+		c.policies = make(map[string]*Policy)
+	}
+	c.policies[tool] = p
+}
+
+// SetApprover 设置审批钩子，未设置时需要审批的调用一律拒绝
+func (c *MCPClient) SetApprover(approver Approver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.approver = approver
+}
+
+// Approvals 返回审批记录
+func (c *MCPClient) Approvals() []ApprovalRecord {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]ApprovalRecord(nil), c.approvals...)
+}
+
+// SetPolicy 全局函数，操作默认客户端
+func SetPolicy(tool string, opts ...PolicyOption) {
+	defaultClient.SetPolicy(tool, opts...)
+}
+
+// SetApprover 全局函数，操作默认客户端
+func SetApprover(approver Approver) {
+	defaultClient.SetApprover(approver)
+}
+
+// authorize 在执行工具前应用策略，返回错误表示拒绝
+func (c *MCPClient) authorize(ctx context.Context, name, arguments string) error {
+	c.mu.RLock()
+	p, ok := c.policies[name]
+	if !ok {
+		p = c.policies["*"]
+	}
+	approver := c.approver
+	c.mu.RUnlock()
+	if p == nil {
+		return nil
+	}
+
+	if p.Decision == Deny {
+		return fmt.Errorf("%w: tool %s is not allowed", ErrPolicyDenied, name)
+	}
+	if len(p.Constraints) > 0 {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return fmt.Errorf("failed to unmarshal arguments for tool %s: %w", name, err)
+		}
+		if err := checkArgKeys(args); err != nil {
+			return fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+		}
+		for _, check := range p.Constraints {
+			if err := check(args); err != nil {
+				return fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+			}
+		}
+	}
+	if p.Decision != RequireApproval {
+		if !p.allowCall(time.Now()) {
+			return rateLimited(p, name)
+		}
+		return nil
+	}
+
+	// 超出频率限制时不打扰审批人，审批通过后才计入调用次数，被拒绝的调用不占用额度
+	if !p.withinLimit(time.Now()) {
+		return rateLimited(p, name)
+	}
+
+	if approver == nil {
+		return fmt.Errorf("%w: tool %s requires approval but no approver is configured", ErrPolicyDenied, name)
+	}
+	req := ApprovalRequest{Tool: name, Arguments: arguments}
+	approval, err := approver(ctx, req)
+	if err != nil {
+		return fmt.Errorf("%w: approval failed: %v", ErrPolicyDenied, err)
+	}
+	if approval.At.IsZero() {
+		approval.At = time.Now()
+	}
+	c.mu.Lock()
+	c.approvals = append(c.approvals, ApprovalRecord{ApprovalRequest: req, Approval: approval})
+	c.mu.Unlock()
+
+	if !approval.Approved {
+		if approval.Reason != "" {
+			return fmt.Errorf("%w: rejected by %s: %s", ErrPolicyDenied, approval.By, approval.Reason)
+		}
+		return fmt.Errorf("%w: rejected by %s", ErrPolicyDenied, approval.By)
+	}
+	// 审批期间其他调用可能已用完额度
+	if !p.allowCall(time.Now()) {
+		return rateLimited(p, name)
+	}
+	return nil
+}
+
+func rateLimited(p *Policy, name string) error {
+	return fmt.Errorf("%w: rate limit of %d calls per %v exceeded for %s", ErrPolicyDenied, p.RateLimit, p.RatePeriod, name)
+}
+
+// ConsoleApprover 在终端询问确认，输入 y 或 yes 表示同意，by 记录为审批人
+func ConsoleApprover(r io.Reader, w io.Writer, by string) Approver {
+	var mu sync.Mutex
+	var once sync.Once
+	lines := make(chan string)
+	return func(ctx context.Context, req ApprovalRequest) (Approval, error) {
+		// 只启动一个读取协程，取消的审批不会吞掉下一次的输入
+		once.Do(func() {
+			go func() {
+				scanner := bufio.NewScanner(r)
+				for scanner.Scan() {
+					lines <- strings.ToLower(strings.TrimSpace(scanner.Text()))
+				}
+				close(lines)
+			}()
+		})
+		// 同一时间只询问一个调用
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "Approve %s %s? [y/N] ", req.Tool, req.Arguments)
+
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return Approval{}, io.EOF
+			}
+			approved := line == "y" || line == "yes"
+			return Approval{Approved: approved, By: by, At: time.Now()}, nil
+		case <-ctx.Done():
+			return Approval{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TradeArgs struct {
+	Symbol   string  `json:"symbol"`
+	Quantity float64 `json:"quantity"`
+}
+
+func newPolicyClient() (*MCPClient, *int) {
+	client := NewMCPClient()
+	executed := 0
+	Register(client, "buy", "", func(ctx context.Context, args TradeArgs) (string, error) {
+		executed++
+		return "ok", nil
+	})
+	Register(client, "balance", "", func(ctx context.Context, args struct{}) (string, error) {
+		return "100", nil
+	})
+	return client, &executed
+}
+
+func TestPolicy_DenyAndConstraints(t *testing.T) {
+	client, executed := newPolicyClient()
+	client.SetPolicy("buy", MaxValue("quantity", 0.1), OneOf("symbol", "BTCUSDT"))
+	client.SetPolicy("*", DenyTool())
+
+	call := func(name, args string) error {
+		executor, _ := client.lookup(name)
+		_, err := client.invoke(context.Background(), executor, args)
+		return err
+	}
+
+	if err := call("buy", `{"symbol":"BTCUSDT","quantity":0.05}`); err != nil {
+		t.Errorf("Expected call within limits to pass, got %v", err)
+	}
+	err := call("buy", `{"symbol":"BTCUSDT","quantity":5}`)
+	if !errors.Is(err, ErrPolicyDenied) || !strings.Contains(err.Error(), "quantity=5 exceeds max 0.1") {
+		t.Errorf("Expected max quantity violation, got %v", err)
+	}
+	if err := call("buy", `{"symbol":"ETHUSDT","quantity":0.01}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected symbol violation, got %v", err)
+	}
+	// 工具解码参数时不区分大小写，策略也必须如此
+	if err := call("buy", `{"symbol":"BTCUSDT","Quantity":100}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected wrong-case quantity to be checked, got %v", err)
+	}
+	if err := call("buy", `{"symbol":"BTCUSDT","quantity":0.01,"QUANTITY":100}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected ambiguous quantity to be denied, got %v", err)
+	}
+	for _, args := range []string{`{"symbol":"BTCUSDT"}`, `{"symbol":"BTCUSDT","quantity":"lots"}`, `{"quantity":0.01}`} {
+		if err := call("buy", args); !errors.Is(err, ErrPolicyDenied) {
+			t.Errorf("Expected missing or invalid argument to be denied for %s, got %v", args, err)
+		}
+	}
+	// 未单独配置的工具使用 "*" 策略
+	if err := call("balance", `{}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected default deny, got %v", err)
+	}
+	if *executed != 1 {
+		t.Errorf("Denied calls must not execute, executed %d times", *executed)
+	}
+}
+
+func TestPolicy_RateLimit(t *testing.T) {
+	client, executed := newPolicyClient()
+	client.SetPolicy("buy", RateLimit(2, 50*time.Millisecond))
+	executor, _ := client.lookup("buy")
+
+	for i := 0; i < 3; i++ {
+		_, err := client.invoke(context.Background(), executor, `{}`)
+		if (i < 2) != (err == nil) {
+			t.Errorf("Call %d: unexpected result %v", i, err)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.invoke(context.Background(), executor, `{}`); err != nil {
+		t.Errorf("Expected call after window to pass, got %v", err)
+	}
+	if *executed != 3 {
+		t.Errorf("Expected 3 executions, got %d", *executed)
+	}
+}
+
+func TestPolicy_Approval(t *testing.T) {
+	client, executed := newPolicyClient()
+	client.SetPolicy("buy", NeedApproval())
+	executor, _ := client.lookup("buy")
+
+	if _, err := client.invoke(context.Background(), executor, `{}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected denial without approver, got %v", err)
+	}
+
+	client.SetApprover(func(ctx context.Context, req ApprovalRequest) (Approval, error) {
+		if strings.Contains(req.Arguments, `"quantity":1`) {
+			return Approval{Approved: false, By: "alice", Reason: "too large"}, nil
+		}
+		return Approval{Approved: true, By: "alice"}, nil
+	})
+	if _, err := client.invoke(context.Background(), executor, `{"quantity":0.1}`); err != nil {
+		t.Errorf("Expected approved call, got %v", err)
+	}
+	_, err := client.invoke(context.Background(), executor, `{"quantity":1}`)
+	if err == nil || err.Error() != "denied by policy: rejected by alice: too large" {
+		t.Errorf("Expected rejection, got %v", err)
+	}
+
+	records := client.Approvals()
+	if len(records) != 2 || !records[0].Approved || records[1].Approved || records[0].By != "alice" || records[0].At.IsZero() {
+		t.Errorf("Unexpected approval records: %+v", records)
+	}
+	if *executed != 1 {
+		t.Errorf("Expected 1 execution, got %d", *executed)
+	}
+}
+
+func TestPolicy_RateLimitAfterApproval(t *testing.T) {
+	client, executed := newPolicyClient()
+	client.SetPolicy("buy", RateLimit(1, time.Hour), NeedApproval())
+	executor, _ := client.lookup("buy")
+	asked := 0
+	client.SetApprover(func(ctx context.Context, req ApprovalRequest) (Approval, error) {
+		asked++
+		return Approval{Approved: !strings.Contains(req.Arguments, "reject"), By: "alice"}, nil
+	})
+
+	// 被拒绝的调用不占用额度
+	if _, err := client.invoke(context.Background(), executor, `{"symbol":"reject"}`); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Expected rejection, got %v", err)
+	}
+	if _, err := client.invoke(context.Background(), executor, `{}`); err != nil {
+		t.Errorf("Expected approved call within limit, got %v", err)
+	}
+	// 额度用完后不再请求审批
+	_, err := client.invoke(context.Background(), executor, `{}`)
+	if !errors.Is(err, ErrPolicyDenied) || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("Expected rate limit, got %v", err)
+	}
+	if asked != 2 || *executed != 1 {
+		t.Errorf("Expected 2 approvals and 1 execution, got %d and %d", asked, *executed)
+	}
+}
+
+func TestConsoleApprover(t *testing.T) {
+	var out bytes.Buffer
+	approver := ConsoleApprover(strings.NewReader("y\nno\n"), &out, "cli")
+
+	req := ApprovalRequest{Tool: "buy", Arguments: `{"quantity":1}`}
+	first, _ := approver(context.Background(), req)
+	second, _ := approver(context.Background(), req)
+	if !first.Approved || second.Approved || first.By != "cli" {
+		t.Errorf("Unexpected approvals: %+v %+v", first, second)
+	}
+	if !strings.Contains(out.String(), `Approve buy {"quantity":1}? [y/N]`) {
+		t.Errorf("Unexpected prompt: %q", out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blocked := ConsoleApprover(blockingReader{}, &out, "cli")
+	if _, err := blocked(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context error, got %v", err)
+	}
+}
+
+type blockingReader struct{}
+
+func (blockingReader) Read(p []byte) (int, error) {
+	select {}
+}
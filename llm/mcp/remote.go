@@ -0,0 +1,430 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrRemoteClosed 远程 MCP 服务端连接已关闭
+var ErrRemoteClosed = errors.New("mcp: remote server closed")
+
+// rpcTransport 向远程服务端发送 JSON-RPC 消息
+type rpcTransport interface {
+	// call 发送请求并等待对应 id 的响应
+	call(ctx context.Context, req *rpcMessage) (*rpcMessage, error)
+	// notify 发送通知，不等待响应
+	notify(ctx context.Context, msg *rpcMessage) error
+	close() error
+}
+
+// RemoteServer 是与外部 MCP 服务端的一个已初始化会话
+type RemoteServer struct {
+	transport rpcTransport
+	nextID    atomic.Int64
+	info      implementation
+	version   string
+}
+
+// ConnectStdio 启动子进程并通过其标准输入输出连接 MCP 服务端
+// 子进程的标准错误输出会转发到当前进程的标准错误
+func ConnectStdio(ctx context.Context, command string, args ...string) (*RemoteServer, error) {
+	t, err := newStdioTransport(exec.Command(command, args...))
+	if err != nil {
+		return nil, err
+	}
+	return connect(ctx, t)
+}
+
+// ConnectHTTP 连接 streamable HTTP 传输的 MCP 服务端，httpClient 为 nil 时使用 http.DefaultClient
+func ConnectHTTP(ctx context.Context, url string, httpClient *http.Client) (*RemoteServer, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return connect(ctx, &httpTransport{url: url, client: httpClient})
+}
+
+// connect 完成 initialize 握手
+func connect(ctx context.Context, t rpcTransport) (*RemoteServer, error) {
+	r := &RemoteServer{transport: t}
+	var result initializeResult
+	err := r.request(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      implementation{Name: "cage", Version: "1.0.0"},
+	}, &result)
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("mcp: initialize failed: %w", err)
+	}
+	supported := false
+	for _, v := range supportedVersions {
+		supported = supported || v == result.ProtocolVersion
+	}
+	if !supported {
+		t.close()
+		return nil, fmt.Errorf("mcp: unsupported protocol version %q", result.ProtocolVersion)
+	}
+	r.info = result.ServerInfo
+	r.version = result.ProtocolVersion
+
+	if err := t.notify(ctx, &rpcMessage{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		t.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Name 返回服务端在 initialize 中声明的名称
+func (r *RemoteServer) Name() string {
+	return r.info.Name
+}
+
+func (r *RemoteServer) request(ctx context.Context, method string, params, result interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id := strconv.FormatInt(r.nextID.Add(1), 10)
+	resp, err := r.transport.call(ctx, &rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: raw})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// ListTools 列出远程服务端的工具
+func (r *RemoteServer) ListTools(ctx context.Context) ([]Tool, error) {
+	var result listToolsResult
+	if err := r.request(ctx, "tools/list", struct{}{}, &result); err != nil {
+		return nil, err
+	}
+	return result.Tools, nil
+}
+
+// CallTool 调用远程工具，arguments 为 JSON 对象
+func (r *RemoteServer) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	if err := r.request(ctx, "tools/call", callToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close 关闭连接，stdio 服务端的子进程会随之退出
+func (r *RemoteServer) Close() error {
+	return r.transport.close()
+}
+
+// AddRemote 将远程服务端的工具合并进本地注册表，与本地工具共用 GetToolsDefinition 和 ExecuteToolCalls
+// prefix 非空时加在工具名前，用于避免重名
+func (c *MCPClient) AddRemote(ctx context.Context, server *RemoteServer, prefix string) error {
+	tools, err := server.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tool := range tools {
+		remoteName := tool.Name
+		schema := tool.InputSchema
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		c.register(&ToolExecutor{
+			Name:        prefix + remoteName,
+			Description: tool.Description,
+			Schema:      schema,
+			invoke: func(ctx context.Context, arguments string) (interface{}, error) {
+				result, err := server.CallTool(ctx, remoteName, json.RawMessage(arguments))
+				if err != nil {
+					return nil, err
+				}
+				text := result.Text()
+				if result.IsError {
+					return nil, errors.New(strings.TrimPrefix(text, "Error: "))
+				}
+				// JSON 结果原样传递，避免被再次转义成字符串
+				if json.Valid([]byte(text)) {
+					return json.RawMessage(text), nil
+				}
+				return text, nil
+			},
+		}, nil)
+	}
+	return nil
+}
+
+// AddRemote 全局函数，操作默认客户端
+func AddRemote(ctx context.Context, server *RemoteServer, prefix string) error {
+	return defaultClient.AddRemote(ctx, server, prefix)
+}
+
+// --- stdio 传输 ---
+
+type stdioTransport struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *rpcMessage
+	err     error // 读取循环结束的原因
+	done    chan struct{}
+}
+
+func newStdioTransport(cmd *exec.Cmd) (*stdioTransport, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan *rpcMessage),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			t.handleServerMessage(&msg)
+			continue
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[string(msg.ID)]
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+		if ok {
+			ch <- &msg
+		}
+	}
+
+	t.mu.Lock()
+	t.err = scanner.Err()
+	if t.err == nil {
+		t.err = ErrRemoteClosed
+	}
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// handleServerMessage 响应服务端发起的请求，目前只支持 ping
+func (t *stdioTransport) handleServerMessage(msg *rpcMessage) {
+	if msg.isNotification() {
+		return
+	}
+	resp := errorResponse(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	if msg.Method == "ping" {
+		resp = &rpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("{}")}
+	}
+	t.write(resp)
+}
+
+func (t *stdioTransport) write(msg *rpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req *rpcMessage) (*rpcMessage, error) {
+	ch := make(chan *rpcMessage, 1)
+	id := string(req.ID)
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	if err := t.write(req); err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		// 通知服务端放弃该请求
+		params, _ := json.Marshal(map[string]interface{}{"requestId": req.ID, "reason": ctx.Err().Error()})
+		t.write(&rpcMessage{JSONRPC: "2.0", Method: "notifications/cancelled", Params: params})
+		return nil, ctx.Err()
+	case <-t.done:
+		return nil, t.err
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, msg *rpcMessage) error {
+	return t.write(msg)
+}
+
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	err := t.cmd.Wait()
+	<-t.done
+	return err
+}
+
+// --- streamable HTTP 传输 ---
+
+type httpTransport struct {
+	url     string
+	client  *http.Client
+	mu      sync.Mutex
+	session string
+}
+
+func (t *httpTransport) post(ctx context.Context, msg *rpcMessage) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set("Mcp-Session-Id", t.session)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if session := resp.Header.Get("Mcp-Session-Id"); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("mcp: %s: %s: %s", t.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, req *rpcMessage) (*rpcMessage, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var msg rpcMessage
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+	}
+
+	// SSE 流：逐个事件读取，直到出现对应 id 的响应
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var msg rpcMessage
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err == nil && msg.Method == "" && string(msg.ID) == string(req.ID) {
+			return &msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrRemoteClosed
+}
+
+func (t *httpTransport) notify(ctx context.Context, msg *rpcMessage) error {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// close 结束会话
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", session)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// TestHelperProcess 不是真正的测试：ConnectStdio 以子进程方式运行测试二进制，
+// 由它充当外部 MCP 服务端
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("MCP_HELPER_PROCESS") != "1" {
+		t.Skip("helper process only")
+	}
+	client := NewMCPClient()
+	client.RegisterTool("multiply", multiplyFunc, MultiplyArgs{}, WithDescription("multiply two numbers"))
+	client.RegisterTool("fail", failingFunc, AddArgs{})
+	NewServer(client, WithServerInfo("fake", "0.1")).ServeStdio(context.Background(), os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+func TestRemote_Stdio(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	os.Setenv("MCP_HELPER_PROCESS", "1")
+	defer os.Unsetenv("MCP_HELPER_PROCESS")
+	server, err := ConnectStdio(ctx, os.Args[0], "-test.run=^TestHelperProcess$")
+	if err != nil {
+		t.Fatalf("ConnectStdio failed: %v", err)
+	}
+	defer server.Close()
+	if server.Name() != "fake" {
+		t.Errorf("Expected server name 'fake', got %q", server.Name())
+	}
+
+	client := NewMCPClient()
+	client.RegisterTool("add", addFunc, AddArgs{})
+	if err := client.AddRemote(ctx, server, "remote_"); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+
+	tools, _ := client.GetToolsDefinition()
+	if len(tools) != 3 || tools[2].Function.Name != "remote_multiply" || tools[2].Function.Description != openai.String("multiply two numbers") {
+		t.Fatalf("Expected local and remote tools, got %+v", tools)
+	}
+
+	message := openai.ChatCompletionMessage{
+		ToolCalls: []openai.ChatCompletionMessageToolCall{
+			{ID: "call_1", Function: openai.ChatCompletionMessageToolCallFunction{Name: "add", Arguments: `{"a": 1, "b": 2}`}},
+			{ID: "call_2", Function: openai.ChatCompletionMessageToolCallFunction{Name: "remote_multiply", Arguments: `{"x": 4, "y": 5}`}},
+			{ID: "call_3", Function: openai.ChatCompletionMessageToolCallFunction{Name: "remote_fail", Arguments: `{}`}},
+		},
+	}
+	results, err := client.ExecuteToolCallsContext(ctx, message)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls failed: %v", err)
+	}
+	if results[1].OfTool.Content.OfString != openai.String(`{"result":20}`) {
+		t.Errorf("Unexpected remote result: %v", results[1].OfTool.Content.OfString)
+	}
+	if results[2].OfTool.Content.OfString != openai.String("Error: this function always fails") {
+		t.Errorf("Unexpected remote error: %v", results[2].OfTool.Content.OfString)
+	}
+}
+
+func TestRemote_HTTP(t *testing.T) {
+	srv := httptest.NewServer(newTestServer())
+	defer srv.Close()
+
+	ctx := context.Background()
+	server, err := ConnectHTTP(ctx, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("ConnectHTTP failed: %v", err)
+	}
+	defer server.Close()
+
+	result, err := server.CallTool(ctx, "add", []byte(`{"a": 2, "b": 2}`))
+	if err != nil || result.IsError || result.Text() != `{"result":4}` {
+		t.Fatalf("Unexpected result: %+v (%v)", result, err)
+	}
+	if _, err := server.CallTool(ctx, "missing", nil); err == nil {
+		t.Error("Expected error for unknown tool")
+	}
+}
@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerateSchema 通过反射从参数结构体生成 JSON Schema
+//
+// 支持的 struct tag：
+//   - json:"name,omitempty"  字段名；没有 omitempty 的字段视为必填，"-" 忽略
+//   - desc:"..."             字段描述
+//   - enum:"a,b,c"           可选值，数字类型会按数字解析
+//   - min:"0.001" max:"100"  数值上下限（字符串和数组为长度上下限）
+//
+// 嵌套结构体、指针、切片、map 和 time.Time 均会递归展开
+func GenerateSchema(v interface{}) map[string]interface{} {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return typeSchema(t, map[reflect.Type]bool{})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeSchema 生成类型的 schema，seen 用于避免递归类型死循环
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// 递归类型不再展开
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		return structSchema(t, seen)
+	}
+	// interface{} 等任意类型
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitempty, skip := jsonName(field)
+		if skip {
+			continue
+		}
+
+		// 匿名嵌入的结构体字段提升到外层，与 encoding/json 行为一致
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := typeSchema(ft, seen)
+				if props, ok := embedded["properties"].(map[string]interface{}); ok {
+					for k, v := range props {
+						properties[k] = v
+					}
+				}
+				if req, ok := embedded["required"].([]string); ok {
+					required = append(required, req...)
+				}
+				continue
+			}
+		}
+
+		schema := typeSchema(field.Type, seen)
+		applyTags(schema, field)
+		properties[name] = schema
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonName 解析 json tag，返回字段名、是否 omitempty、是否忽略
+func jsonName(field reflect.StructField) (name string, omitempty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" || opt == "omitzero" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, false
+}
+
+// applyTags 将 desc、enum、min、max 写入字段 schema
+func applyTags(schema map[string]interface{}, field reflect.StructField) {
+	if desc := field.Tag.Get("desc"); desc != "" {
+		schema["description"] = desc
+	}
+
+	typ, _ := schema["type"].(string)
+	if enum := field.Tag.Get("enum"); enum != "" {
+		values := []interface{}{}
+		for _, e := range strings.Split(enum, ",") {
+			e = strings.TrimSpace(e)
+			if typ == "number" || typ == "integer" {
+				if n, err := strconv.ParseFloat(e, 64); err == nil {
+					values = append(values, n)
+					continue
+				}
+			}
+			values = append(values, e)
+		}
+		schema["enum"] = values
+	}
+
+	bounds := map[string]string{"min": "minimum", "max": "maximum"}
+	switch typ {
+	case "string":
+		bounds = map[string]string{"min": "minLength", "max": "maxLength"}
+	case "array":
+		bounds = map[string]string{"min": "minItems", "max": "maxItems"}
+	}
+	for tag, key := range bounds {
+		s := field.Tag.Get(tag)
+		if s == "" {
+			continue
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			schema[key] = n
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package mcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type OrderLeg struct {
+	Price float64 `json:"price" min:"0"`
+}
+
+type OrderArgs struct {
+	Symbol   string     `json:"symbol" desc:"交易对" enum:"BTCUSDT,ETHUSDT"`
+	Quantity float64    `json:"quantity" min:"0.001" max:"10"`
+	Leverage int        `json:"leverage,omitempty" enum:"1,5,10"`
+	Legs     []OrderLeg `json:"legs,omitempty" max:"3"`
+	Note     *string    `json:"note,omitempty" max:"200"`
+	At       time.Time  `json:"at,omitempty"`
+	Next     *OrderArgs `json:"next,omitempty"`
+	Ignored  string     `json:"-"`
+	internal string
+}
+
+func TestGenerateSchema(t *testing.T) {
+	schema := GenerateSchema(OrderArgs{})
+	data, _ := json.Marshal(schema)
+
+	var got struct {
+		Required   []string                  `json:"required"`
+		Properties map[string]map[string]any `json:"properties"`
+	}
+	json.Unmarshal(data, &got)
+
+	if !reflect.DeepEqual(got.Required, []string{"symbol", "quantity"}) {
+		t.Errorf("Unexpected required fields: %v", got.Required)
+	}
+	if len(got.Properties) != 7 {
+		t.Errorf("Expected 7 properties, got %s", data)
+	}
+
+	symbol := got.Properties["symbol"]
+	if symbol["description"] != "交易对" || len(symbol["enum"].([]any)) != 2 {
+		t.Errorf("Unexpected symbol schema: %v", symbol)
+	}
+	qty := got.Properties["quantity"]
+	if qty["type"] != "number" || qty["minimum"] != 0.001 || qty["maximum"] != 10.0 {
+		t.Errorf("Unexpected quantity schema: %v", qty)
+	}
+	if got.Properties["leverage"]["enum"].([]any)[1] != 5.0 {
+		t.Errorf("Integer enum should be numeric: %v", got.Properties["leverage"])
+	}
+	legs := got.Properties["legs"]
+	items := legs["items"].(map[string]any)
+	if legs["maxItems"] != 3.0 || items["properties"].(map[string]any)["price"].(map[string]any)["minimum"] != 0.0 {
+		t.Errorf("Unexpected nested schema: %v", legs)
+	}
+	if got.Properties["note"]["maxLength"] != 200.0 || got.Properties["at"]["format"] != "date-time" {
+		t.Errorf("Unexpected note/at schema: %v %v", got.Properties["note"], got.Properties["at"])
+	}
+	if got.Properties["next"]["type"] != "object" {
+		t.Errorf("Recursive type should stop at object: %v", got.Properties["next"])
+	}
+}
+
+func TestMCPClient_GetToolsDefinition(t *testing.T) {
+	client := NewMCPClient()
+	client.RegisterTool("multiply", multiplyFunc, MultiplyArgs{})
+	client.RegisterTool("add", addFunc, AddArgs{}, WithDescription("add two numbers"))
+
+	tools, err := client.GetToolsDefinition()
+	if err != nil {
+		t.Fatalf("GetToolsDefinition failed: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Function.Name != "add" || tools[1].Function.Name != "multiply" {
+		t.Fatalf("Expected tools sorted by name, got %+v", tools)
+	}
+
+	data, _ := json.Marshal(tools[0])
+	var got map[string]any
+	json.Unmarshal(data, &got)
+	fn := got["function"].(map[string]any)
+	params := fn["parameters"].(map[string]any)
+	if got["type"] != "function" || fn["description"] != "add two numbers" || len(params["required"].([]any)) != 2 {
+		t.Errorf("Unexpected tool definition: %s", data)
+	}
+}
@@ -0,0 +1,552 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+// stateURIPrefix 状态条目作为资源暴露时的 URI 前缀
+const stateURIPrefix = "state://"
+
+// Server 通过 Model Context Protocol 暴露 MCPClient 中注册的工具
+// 支持 stdio（ServeStdio）和 streamable HTTP（作为 http.Handler）两种传输
+type Server struct {
+	client  *MCPClient
+	info    implementation
+	state   *state.StateManager
+	token   string          // 非空时 HTTP 请求必须携带 Authorization: Bearer <token>
+	origins map[string]bool // 除本机外允许的 Origin
+	mu      sync.Mutex
+	session map[string]time.Time // streamable HTTP 会话及最后一次请求的时间
+
+	sessionTTL  time.Duration // 会话空闲超过该时长后失效
+	maxSessions int
+}
+
+const (
+	// DefaultSessionTTL HTTP 会话默认的空闲过期时间
+	DefaultSessionTTL = 30 * time.Minute
+	// DefaultMaxSessions 默认同时存在的 HTTP 会话上限
+	DefaultMaxSessions = 1000
+)
+
+// ServerOption 服务端可选配置
+type ServerOption func(*Server)
+
+// WithServerInfo 设置 initialize 时返回的服务端名称和版本
+func WithServerInfo(name, version string) ServerOption {
+	return func(s *Server) {
+		s.info = implementation{Name: name, Version: version}
+	}
+}
+
+// WithStateResources 将 StateManager 中的条目以 state://<key> 资源的形式只读暴露
+func WithStateResources(sm *state.StateManager) ServerOption {
+	return func(s *Server) {
+		s.state = sm
+	}
+}
+
+// WithBearerToken 要求 HTTP 请求携带 Authorization: Bearer <token>
+func WithBearerToken(token string) ServerOption {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// WithAllowedOrigins 允许来自这些 Origin（如 "https://app.example.com"）的浏览器请求
+// 默认只允许 localhost、127.0.0.1 和 [::1]，用于防止 DNS 重绑定攻击
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		if s.origins == nil {
+			s.origins = make(map[string]bool)
+		}
+		for _, origin := range origins {
+			s.origins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+}
+
+// WithSessionLimits 设置 HTTP 会话的空闲过期时间和数量上限，默认 DefaultSessionTTL 和 DefaultMaxSessions
+// 达到上限时新的 initialize 请求返回 503，直到有会话过期或被 DELETE 结束
+func WithSessionLimits(ttl time.Duration, max int) ServerOption {
+	return func(s *Server) {
+		s.sessionTTL = ttl
+		s.maxSessions = max
+	}
+}
+
+// NewServer 创建 MCP 服务端，client 为 nil 时使用默认客户端
+func NewServer(client *MCPClient, opts ...ServerOption) *Server {
+	if client == nil {
+		client = defaultClient
+	}
+	s := &Server{
+		client:      client,
+		info:        implementation{Name: "cage", Version: "1.0.0"},
+		session:     make(map[string]time.Time),
+		sessionTTL:  DefaultSessionTTL,
+		maxSessions: DefaultMaxSessions,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Handle 处理一条 JSON-RPC 消息（或批量消息），返回需要发送的响应
+// 只包含通知时返回 nil
+func (s *Server) Handle(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return mustMarshal(errorResponse(nil, codeParseError, err.Error()))
+		}
+		var responses []*rpcMessage
+		for _, raw := range batch {
+			if resp := s.handleOne(ctx, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return mustMarshal(responses)
+	}
+	if resp := s.handleOne(ctx, data); resp != nil {
+		return mustMarshal(resp)
+	}
+	return nil
+}
+
+func (s *Server) handleOne(ctx context.Context, data []byte) *rpcMessage {
+	var req rpcMessage
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(nil, codeParseError, err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.Method == "" && (req.Result != nil || req.Error != nil) {
+			// 客户端发来的响应，服务端没有发出过请求，忽略
+			return nil
+		}
+		return errorResponse(req.ID, codeInvalidRequest, "invalid JSON-RPC request")
+	}
+
+	result, err := s.dispatch(ctx, &req)
+	if req.isNotification() {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) {
+			return &rpcMessage{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+		}
+		return errorResponse(req.ID, codeInternalError, err.Error())
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, codeInternalError, err.Error())
+	}
+	return &rpcMessage{JSONRPC: "2.0", ID: req.ID, Result: raw}
+}
+
+func (s *Server) dispatch(ctx context.Context, req *rpcMessage) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		var params initializeParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.initialize(params), nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return listToolsResult{Tools: s.client.mcpTools()}, nil
+	case "tools/call":
+		var params callToolParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, params)
+	case "resources/list":
+		if s.state == nil {
+			break
+		}
+		return listResourcesResult{Resources: s.resources()}, nil
+	case "resources/read":
+		if s.state == nil {
+			break
+		}
+		var params readResourceParams
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.readResource(params.URI)
+	}
+	return nil, &RPCError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+// initialize 协商协议版本：客户端请求的版本受支持时原样返回，否则返回最新版本
+func (s *Server) initialize(params initializeParams) initializeResult {
+	version := ProtocolVersion
+	for _, v := range supportedVersions {
+		if v == params.ProtocolVersion {
+			version = v
+		}
+	}
+	caps := map[string]interface{}{
+		"tools": map[string]interface{}{"listChanged": false},
+	}
+	if s.state != nil {
+		caps["resources"] = map[string]interface{}{"subscribe": false, "listChanged": false}
+	}
+	return initializeResult{ProtocolVersion: version, Capabilities: caps, ServerInfo: s.info}
+}
+
+// callTool 执行工具，工具自身的错误通过 isError 返回给模型而不是协议错误
+func (s *Server) callTool(ctx context.Context, params callToolParams) (*CallToolResult, error) {
+	executor, ok := s.client.lookup(params.Name)
+	if !ok {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	args := string(params.Arguments)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+
+	result, err := s.client.invoke(ctx, executor, args)
+	if err != nil {
+		return &CallToolResult{Content: []Content{{Type: "text", Text: "Error: " + err.Error()}}, IsError: true}, nil
+	}
+	text, ok := result.(string)
+	if !ok {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tool result for %s: %w", params.Name, err)
+		}
+		text = string(data)
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: text}}}, nil
+}
+
+func (s *Server) resources() []Resource {
+	all := s.state.GetAll()
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resources := make([]Resource, 0, len(keys))
+	for _, key := range keys {
+		resources = append(resources, Resource{URI: stateURIPrefix + key, Name: key, MimeType: "application/json"})
+	}
+	return resources
+}
+
+func (s *Server) readResource(uri string) (*readResourceResult, error) {
+	key, ok := strings.CutPrefix(uri, stateURIPrefix)
+	if !ok {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "unknown resource: " + uri}
+	}
+	value, ok := s.state.Get(key)
+	if !ok {
+		return nil, &RPCError{Code: codeInvalidParams, Message: "resource not found: " + uri}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &readResourceResult{Contents: []resourceContents{{URI: uri, MimeType: "application/json", Text: string(data)}}}, nil
+}
+
+// mcpTools 以 MCP 格式列出注册的工具，按名称排序
+func (c *MCPClient) mcpTools() []Tool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.tools))
+	for name := range c.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]Tool, 0, len(names))
+	for _, name := range names {
+		executor := c.tools[name]
+		tools = append(tools, Tool{Name: name, Description: executor.Description, InputSchema: executor.Schema})
+	}
+	return tools
+}
+
+// ServeStdio 在 r/w 上以换行分隔的 JSON-RPC 消息提供服务，直到 r 结束或 ctx 取消
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// 在单独的协程中读取，ctx 取消时不必等到下一行输入
+	lines := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- append([]byte(nil), scanner.Bytes()...):
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case line = <-lines:
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		// 并发处理请求，慢工具不会阻塞 ping 等消息
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := s.Handle(ctx, line)
+			if resp == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			w.Write(append(resp, '\n'))
+		}()
+	}
+}
+
+// ServeStdio 全局函数，在标准输入输出上暴露默认客户端的工具
+func ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	return NewServer(nil).ServeStdio(ctx, r, w)
+}
+
+// ServeHTTP 实现 streamable HTTP 传输：POST 提交 JSON-RPC 消息，响应以 application/json 返回
+// 本实现不主动推送消息，因此 GET 返回 405；DELETE 结束会话
+// 除 initialize 外的请求都必须携带 initialize 时分配的 Mcp-Session-Id
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.allowedOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		if !s.endSession(r.Header.Get("Mcp-Session-Id")) {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var head rpcMessage
+	json.Unmarshal(body, &head)
+	sessionID := r.Header.Get("Mcp-Session-Id")
+	if head.Method == "initialize" {
+		if sessionID = s.newSession(); sessionID == "" {
+			http.Error(w, "too many sessions", http.StatusServiceUnavailable)
+			return
+		}
+	} else if sessionID == "" {
+		http.Error(w, "missing Mcp-Session-Id, call initialize first", http.StatusBadRequest)
+		return
+	} else if !s.touchSession(sessionID) {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	resp := s.Handle(r.Context(), body)
+	w.Header().Set("Mcp-Session-Id", sessionID)
+	if resp == nil {
+		// 只有通知或响应
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// ListenAndServe 在 addr 上提供 streamable HTTP 服务
+// addr 未指定主机（如 ":8090"）时只监听 127.0.0.1；监听其他地址时必须设置 WithBearerToken
+func (s *Server) ListenAndServe(addr string) error {
+	return s.ListenAndServeContext(context.Background(), addr)
+}
+
+// ListenAndServeContext 同 ListenAndServe，ctx 取消时等待进行中的请求结束后返回 nil
+func (s *Server) ListenAndServeContext(ctx context.Context, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if !isLoopback(host) && s.token == "" {
+		return fmt.Errorf("mcp: refusing to listen on %s without a bearer token", addr)
+	}
+
+	srv := &http.Server{Addr: net.JoinHostPort(host, port), Handler: s}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+		case <-done:
+		}
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// authorized 检查 bearer token，未设置 token 时总是通过
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// allowedOrigin 检查浏览器请求的 Origin，非浏览器客户端不会发送 Origin
+func (s *Server) allowedOrigin(origin string) bool {
+	if origin == "" || s.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && isLoopback(u.Hostname())
+}
+
+// newSession 清理过期会话后创建新会话，达到上限时返回 ""
+func (s *Server) newSession() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, last := range s.session {
+		if s.sessionExpired(last, now) {
+			delete(s.session, id)
+		}
+	}
+	if s.maxSessions > 0 && len(s.session) >= s.maxSessions {
+		return ""
+	}
+	id := newSessionID()
+	s.session[id] = now
+	return id
+}
+
+// touchSession 检查会话是否有效并刷新最后请求时间
+func (s *Server) touchSession(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.session[id]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if s.sessionExpired(last, now) {
+		delete(s.session, id)
+		return false
+	}
+	s.session[id] = now
+	return true
+}
+
+func (s *Server) sessionExpired(last, now time.Time) bool {
+	return s.sessionTTL > 0 && now.Sub(last) > s.sessionTTL
+}
+
+// endSession 结束会话，会话不存在或已过期时返回 false
+func (s *Server) endSession(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.session[id]
+	if !ok {
+		return false
+	}
+	delete(s.session, id)
+	return !s.sessionExpired(last, time.Now())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unmarshalParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &RPCError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *rpcMessage {
+	return &rpcMessage{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: msg}}
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
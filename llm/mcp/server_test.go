@@ -0,0 +1,267 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+func newTestServer() *Server {
+	client := NewMCPClient()
+	client.RegisterTool("add", addFunc, AddArgs{}, WithDescription("add two numbers"))
+	client.RegisterTool("fail", failingFunc, AddArgs{})
+	sm := state.NewStateManager()
+	sm.Set("mcp_test_memory", "buy the dip")
+	return NewServer(client, WithServerInfo("test", "0.1"), WithStateResources(sm))
+}
+
+func TestServer_StdioCancel(t *testing.T) {
+	// 输入一直没有数据时，ctx 取消也能让 ServeStdio 返回
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- newTestServer().ServeStdio(ctx, r, io.Discard) }()
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio did not return after cancel")
+	}
+}
+
+func TestServer_ListenAndServeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- newTestServer().ListenAndServeContext(ctx, "127.0.0.1:0") }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Expected nil after shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ListenAndServeContext did not return after cancel")
+	}
+}
+
+func TestServer_Stdio(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"c","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"add","arguments":{"a":2,"b":3}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"fail","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"resources/read","params":{"uri":"state://mcp_test_memory"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"nope"}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := newTestServer().ServeStdio(context.Background(), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("ServeStdio failed: %v", err)
+	}
+
+	responses := map[string]rpcMessage{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("Invalid response line %q: %v", scanner.Text(), err)
+		}
+		responses[string(msg.ID)] = msg
+	}
+	// 通知没有响应，7 个请求 + 1 个解析错误
+	if len(responses) != 7 {
+		t.Fatalf("Expected 7 responses, got %d: %v", len(responses), out.String())
+	}
+
+	var init initializeResult
+	json.Unmarshal(responses["1"].Result, &init)
+	if init.ProtocolVersion != "2024-11-05" || init.ServerInfo.Name != "test" || init.Capabilities["resources"] == nil {
+		t.Errorf("Unexpected initialize result: %+v", init)
+	}
+
+	var list listToolsResult
+	json.Unmarshal(responses["2"].Result, &list)
+	if len(list.Tools) != 2 || list.Tools[0].Name != "add" || list.Tools[0].InputSchema["type"] != "object" {
+		t.Errorf("Unexpected tools: %+v", list.Tools)
+	}
+
+	var call CallToolResult
+	json.Unmarshal(responses["3"].Result, &call)
+	if call.IsError || call.Text() != `{"result":5}` {
+		t.Errorf("Unexpected call result: %+v", call)
+	}
+	json.Unmarshal(responses["4"].Result, &call)
+	if !call.IsError || call.Text() != "Error: this function always fails" {
+		t.Errorf("Expected isError result, got %+v", call)
+	}
+
+	var read readResourceResult
+	json.Unmarshal(responses["5"].Result, &read)
+	if len(read.Contents) != 1 || read.Contents[0].Text != `"buy the dip"` {
+		t.Errorf("Unexpected resource: %+v", read)
+	}
+
+	if responses["6"].Error == nil || responses["6"].Error.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %+v", responses["6"])
+	}
+	if responses[""].Error == nil || responses[""].Error.Code != codeParseError {
+		t.Errorf("Expected parse error, got %+v", responses[""])
+	}
+}
+
+func TestServer_HTTP(t *testing.T) {
+	srv := httptest.NewServer(newTestServer())
+	defer srv.Close()
+
+	post := func(session, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if session != "" {
+			req.Header.Set("Mcp-Session-Id", session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	session := resp.Header.Get("Mcp-Session-Id")
+	resp.Body.Close()
+	if session == "" {
+		t.Fatal("Expected a session id")
+	}
+
+	resp = post(session, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202 for notification, got %d", resp.StatusCode)
+	}
+
+	resp = post(session, `[{"jsonrpc":"2.0","id":2,"method":"ping"},{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"add","arguments":{"a":1,"b":1}}}]`)
+	var batch []rpcMessage
+	json.NewDecoder(resp.Body).Decode(&batch)
+	resp.Body.Close()
+	if len(batch) != 2 || !strings.Contains(string(batch[1].Result), `{\"result\":2}`) {
+		t.Errorf("Unexpected batch response: %+v", batch)
+	}
+
+	resp = post("unknown", `{"jsonrpc":"2.0","id":4,"method":"ping"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %d", resp.StatusCode)
+	}
+
+	resp = post("", `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"add","arguments":{"a":1,"b":1}}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without session, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_HTTPSessions(t *testing.T) {
+	srv := httptest.NewServer(NewServer(NewMCPClient(), WithSessionLimits(50*time.Millisecond, 2)))
+	defer srv.Close()
+
+	do := func(method, session, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL, strings.NewReader(body))
+		if session != "" {
+			req.Header.Set("Mcp-Session-Id", session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	initialize := func() *http.Response {
+		return do(http.MethodPost, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	}
+	ping := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+
+	first := initialize().Header.Get("Mcp-Session-Id")
+	second := initialize().Header.Get("Mcp-Session-Id")
+	if resp := initialize(); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 above the session limit, got %d", resp.StatusCode)
+	}
+
+	// DELETE 释放名额，已结束的会话不能再使用
+	if resp := do(http.MethodDelete, first, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 for DELETE, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, first, ping); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after DELETE, got %d", resp.StatusCode)
+	}
+	if resp := initialize(); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a free slot after DELETE, got %d", resp.StatusCode)
+	}
+
+	// 空闲超过 TTL 的会话失效
+	time.Sleep(60 * time.Millisecond)
+	if resp := do(http.MethodPost, second, ping); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an idle session, got %d", resp.StatusCode)
+	}
+	if resp := initialize(); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected expired sessions to free their slots, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_HTTPAuth(t *testing.T) {
+	srv := httptest.NewServer(NewServer(NewMCPClient(), WithBearerToken("secret"), WithAllowedOrigins("https://app.example.com")))
+	defer srv.Close()
+
+	initialize := func(token, origin string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		token, origin string
+		want          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"wrong", "", http.StatusUnauthorized},
+		{"secret", "", http.StatusOK},
+		{"secret", "http://localhost:3000", http.StatusOK},
+		{"secret", "https://app.example.com", http.StatusOK},
+		{"secret", "http://evil.example.com", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		if got := initialize(c.token, c.origin); got != c.want {
+			t.Errorf("token %q origin %q: expected %d, got %d", c.token, c.origin, c.want, got)
+		}
+	}
+
+	if err := NewServer(NewMCPClient()).ListenAndServe("0.0.0.0:0"); err == nil || !strings.Contains(err.Error(), "bearer token") {
+		t.Errorf("Expected refusal to listen publicly without token, got %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package state
+
+import (
+	"container/heap"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultJanitorInterval 默认实例清理过期条目的间隔
+const DefaultJanitorInterval = time.Minute
+
+// EvictionPolicy 超出容量时选择淘汰条目的策略
+type EvictionPolicy int
+
+const (
+	EvictLRU EvictionPolicy = iota // 淘汰最久未访问的条目
+	EvictLFU                       // 淘汰访问次数最少的条目，次数相同时淘汰最久未访问的
+)
+
+// ManagerOption NewStateManager 的可选配置
+type ManagerOption func(*managerConfig)
+
+type managerConfig struct {
+	janitor    time.Duration
+	maxEntries int
+	maxBytes   int64
+	policy     EvictionPolicy
+	onExpire   func(key string, value interface{})
+	onEvict    func(key string, value interface{})
+}
+
+// WithJanitor 每隔 interval 在后台清理过期条目，调用 Close 停止
+func WithJanitor(interval time.Duration) ManagerOption {
+	return func(cfg *managerConfig) {
+		cfg.janitor = interval
+	}
+}
+
+// WithMaxEntries 限制条目数，超出时按淘汰策略移除条目
+func WithMaxEntries(n int) ManagerOption {
+	return func(cfg *managerConfig) {
+		cfg.maxEntries = n
+	}
+}
+
+// WithMaxBytes 限制所有键和值的估算大小（值按 JSON 编码长度计算）
+func WithMaxBytes(n int64) ManagerOption {
+	return func(cfg *managerConfig) {
+		cfg.maxBytes = n
+	}
+}
+
+// WithEviction 设置淘汰策略，默认 LRU
+func WithEviction(policy EvictionPolicy) ManagerOption {
+	return func(cfg *managerConfig) {
+		cfg.policy = policy
+	}
+}
+
+// WithOnExpire 条目过期并被清理时回调，key 为包含命名空间前缀的完整键
+func WithOnExpire(fn func(key string, value interface{})) ManagerOption {
+	return func(cfg *managerConfig) {
+		cfg.onExpire = fn
+	}
+}
+
+// WithOnEvict 条目因容量限制被淘汰时回调，key 为包含命名空间前缀的完整键
+func WithOnEvict(fn func(key string, value interface{})) ManagerOption {
+	return func(cfg *managerConfig) {
+		cfg.onEvict = fn
+	}
+}
+
+// Stats 运行统计，Entries 和 Bytes 包含尚未清理的过期条目
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+type counters struct {
+	hits, misses, evictions, expirations atomic.Uint64
+}
+
+// Stats 返回统计信息，命名空间视图与父级共享同一份统计
+func (s *StateManager) Stats() Stats {
+	s.mu.RLock()
+	entries, bytes := len(s.states), s.bytes
+	s.mu.RUnlock()
+	return Stats{
+		Hits:        s.counters.hits.Load(),
+		Misses:      s.counters.misses.Load(),
+		Evictions:   s.counters.evictions.Load(),
+		Expirations: s.counters.expirations.Load(),
+		Entries:     entries,
+		Bytes:       bytes,
+	}
+}
+
+// Close 停止后台清理和自动保存，开启了自动保存时做最后一次保存
+func (s *StateManager) Close() error {
+	s.mu.Lock()
+	stop := s.janitorStop
+	s.janitorStop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+	}
+	return s.stopPersist()
+}
+
+func (s *StateManager) startJanitor(interval time.Duration) {
+	stop := make(chan struct{})
+	s.janitorStop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// 在根视图上清理，覆盖所有命名空间
+				root := &StateManager{store: s.store}
+				root.Cleanup()
+			}
+		}
+	}()
+}
+
+// touch 记录一次访问
+func (e *StateEntry) touch() {
+	e.accessed.Store(time.Now().UnixNano())
+	e.hits.Add(1)
+}
+
+// putLocked 写入条目并维护总大小，调用方必须持有写锁
+func (s *store) putLocked(key string, entry *StateEntry) {
+	if old, ok := s.states[key]; ok {
+		s.bytes -= old.size
+	}
+	entry.size = int64(len(key)) + estimateSize(entry.Value)
+	if entry.accessed.Load() == 0 {
+		entry.accessed.Store(time.Now().UnixNano())
+	}
+	s.bytes += entry.size
+	s.states[key] = entry
+	if s.limited() {
+		s.indexLocked(key, entry)
+	}
+}
+
+// removeLocked 删除条目并维护总大小，调用方必须持有写锁
+// 淘汰索引中的记录不会立即删除，取出时发现已失效再丢弃
+func (s *store) removeLocked(key string) (*StateEntry, bool) {
+	entry, ok := s.states[key]
+	if ok {
+		s.bytes -= entry.size
+		delete(s.states, key)
+	}
+	return entry, ok
+}
+
+// removed 被移除的条目，用于在锁外执行回调
+type removed struct {
+	key     string
+	value   interface{}
+	version uint64
+}
+
+// limited 是否设置了容量限制，未设置时不维护淘汰索引
+func (s *store) limited() bool {
+	return s.cfg.maxEntries > 0 || s.cfg.maxBytes > 0
+}
+
+func (s *store) over() bool {
+	return (s.cfg.maxEntries > 0 && len(s.states) > s.cfg.maxEntries) ||
+		(s.cfg.maxBytes > 0 && s.bytes > s.cfg.maxBytes)
+}
+
+// evictLocked 超出容量时淘汰条目，keep 为刚写入的键，不会被淘汰
+// 优先移除已过期的条目，调用方必须持有写锁
+// 每个被移除的条目只需 O(log n) 从堆中选出，不扫描整个 map
+func (s *store) evictLocked(keep string) (expired, evicted []removed) {
+	if !s.over() {
+		return nil, nil
+	}
+
+	now := time.Now().UnixNano()
+	var kept []indexItem
+	for s.expiries.Len() > 0 {
+		top := s.expiries[0]
+		if !s.current(top) {
+			heap.Pop(&s.expiries)
+			continue
+		}
+		if top.rank > now {
+			break
+		}
+		heap.Pop(&s.expiries)
+		if top.key == keep {
+			kept = append(kept, top)
+			continue
+		}
+		s.removeLocked(top.key)
+		expired = append(expired, removed{top.key, top.entry.Value, top.entry.Version})
+	}
+	for _, item := range kept {
+		heap.Push(&s.expiries, item)
+	}
+
+	kept = kept[:0]
+	for s.over() {
+		victim, ok := s.nextVictimLocked(keep, &kept)
+		if !ok {
+			// 只剩刚写入的条目，即使超出限制也保留
+			break
+		}
+		s.removeLocked(victim.key)
+		evicted = append(evicted, removed{victim.key, victim.entry.Value, victim.entry.Version})
+	}
+	for _, item := range kept {
+		heap.Push(&s.victims, item)
+	}
+	return expired, evicted
+}
+
+// nextVictimLocked 从淘汰堆中取出最应该淘汰的有效条目，keep 对应的记录放入 kept 稍后放回
+func (s *store) nextVictimLocked(keep string, kept *[]indexItem) (indexItem, bool) {
+	for s.victims.Len() > 0 {
+		item := heap.Pop(&s.victims).(indexItem)
+		if !s.current(item) {
+			continue
+		}
+		if item.key == keep {
+			*kept = append(*kept, item)
+			continue
+		}
+		// 入堆后被访问过，按当前的访问记录重新排序；持有写锁时访问记录不会再变化
+		if hits, accessed := s.rank(item.entry); hits != item.hits || accessed != item.rank {
+			item.hits, item.rank = hits, accessed
+			heap.Push(&s.victims, item)
+			continue
+		}
+		return item, true
+	}
+	return indexItem{}, false
+}
+
+// rank 返回条目当前的淘汰排序依据，LRU 只比较访问时间
+func (s *store) rank(entry *StateEntry) (hits uint64, accessed int64) {
+	if s.cfg.policy == EvictLFU {
+		hits = entry.hits.Load()
+	}
+	return hits, entry.accessed.Load()
+}
+
+// current 判断索引记录是否仍对应 map 中的条目，覆盖或删除后的旧记录失效
+func (s *store) current(item indexItem) bool {
+	return s.states[item.key] == item.entry
+}
+
+// indexLocked 将条目加入淘汰和过期索引，失效记录过多时重建索引
+func (s *store) indexLocked(key string, entry *StateEntry) {
+	if s.victims.Len() > 2*len(s.states)+64 {
+		s.rebuildIndexLocked()
+		return
+	}
+	hits, accessed := s.rank(entry)
+	heap.Push(&s.victims, indexItem{key: key, entry: entry, hits: hits, rank: accessed})
+	if entry.ExpiresAt != nil {
+		heap.Push(&s.expiries, indexItem{key: key, entry: entry, rank: entry.ExpiresAt.UnixNano()})
+	}
+}
+
+// rebuildIndexLocked 按 map 中的条目重建索引
+func (s *store) rebuildIndexLocked() {
+	s.victims = s.victims[:0]
+	s.expiries = s.expiries[:0]
+	for key, entry := range s.states {
+		hits, accessed := s.rank(entry)
+		s.victims = append(s.victims, indexItem{key: key, entry: entry, hits: hits, rank: accessed})
+		if entry.ExpiresAt != nil {
+			s.expiries = append(s.expiries, indexItem{key: key, entry: entry, rank: entry.ExpiresAt.UnixNano()})
+		}
+	}
+	heap.Init(&s.victims)
+	heap.Init(&s.expiries)
+}
+
+// indexItem 淘汰或过期索引中的一条记录
+// 淘汰堆按 (hits, rank) 排序，rank 为访问时间；过期堆只按 rank 排序，rank 为过期时间
+type indexItem struct {
+	key   string
+	entry *StateEntry
+	hits  uint64
+	rank  int64
+}
+
+// indexHeap 最小堆，访问只会增大排序依据，因此入堆后的旧排序不会比实际值更大
+type indexHeap []indexItem
+
+func (h indexHeap) Len() int { return len(h) }
+func (h indexHeap) Less(i, j int) bool {
+	if h[i].hits != h[j].hits {
+		return h[i].hits < h[j].hits
+	}
+	return h[i].rank < h[j].rank
+}
+func (h indexHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x interface{}) { *h = append(*h, x.(indexItem)) }
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = indexItem{}
+	*h = old[:len(old)-1]
+	return item
+}
+
+// recordRemoved 更新过期和淘汰统计并通知订阅者，调用方必须持有写锁
+func (s *store) recordRemoved(expired, evicted []removed) {
+	s.counters.expirations.Add(uint64(len(expired)))
+	s.counters.evictions.Add(uint64(len(evicted)))
+	for _, r := range expired {
+		s.emitLocked(EventExpire, r.key, r.value, nil, r.version)
+	}
+	for _, r := range evicted {
+		s.emitLocked(EventEvict, r.key, r.value, nil, r.version)
+	}
+}
+
+// runCallbacks 执行过期和淘汰回调，调用方不能持有锁
+func (s *store) runCallbacks(expired, evicted []removed) {
+	if s.cfg.onExpire != nil {
+		for _, r := range expired {
+			s.cfg.onExpire(r.key, r.value)
+		}
+	}
+	if s.cfg.onEvict != nil {
+		for _, r := range evicted {
+			s.cfg.onEvict(r.key, r.value)
+		}
+	}
+}
+
+// estimateSize 估算值占用的字节数
+func estimateSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		// 无法编码的值按固定大小计算
+		return 64
+	}
+	return int64(len(data))
+}
+
+// inView 判断完整键是否属于当前视图
+func (s *StateManager) inView(key string) bool {
+	return strings.HasPrefix(key, s.prefix)
+}
@@ -0,0 +1,136 @@
+package state_test
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+func TestStateManagerLRUEviction(t *testing.T) {
+	var mu sync.Mutex
+	var evicted []string
+	manager := state.NewStateManager(state.WithMaxEntries(2), state.WithOnEvict(func(key string, value interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, key)
+	}))
+
+	manager.Set("a", 1)
+	time.Sleep(time.Millisecond)
+	manager.Set("b", 2)
+	time.Sleep(time.Millisecond)
+	manager.Get("a") // a 比 b 更近被访问
+	time.Sleep(time.Millisecond)
+	manager.Set("c", 3)
+
+	if got := manager.Keys(""); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("Expected b to be evicted, got keys %v", got)
+	}
+	stats := manager.Stats()
+	if stats.Evictions != 1 || stats.Hits != 1 || stats.Entries != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		got := append([]string(nil), evicted...)
+		mu.Unlock()
+		if reflect.DeepEqual(got, []string{"b"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected eviction callback for b, got %v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStateManagerLFUAndMaxBytes(t *testing.T) {
+	manager := state.NewStateManager(state.WithMaxBytes(30), state.WithEviction(state.EvictLFU))
+	manager.Set("hot", "0123456789")
+	manager.Set("cold", "0123456789")
+	for i := 0; i < 3; i++ {
+		manager.Get("hot")
+	}
+	manager.Get("cold")
+	manager.Get("missing")
+
+	// hot(3+10) + cold(4+10) = 27，再写入 new(3+10) 超出 30 字节
+	manager.Set("new", "0123456789")
+	if got := manager.Keys(""); !reflect.DeepEqual(got, []string{"hot", "new"}) {
+		t.Errorf("Expected least frequently used entry to be evicted, got %v", got)
+	}
+	stats := manager.Stats()
+	if stats.Bytes != 26 || stats.Misses != 1 || stats.Hits != 4 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	manager.Delete("new")
+	if stats := manager.Stats(); stats.Bytes != 13 || stats.Entries != 1 {
+		t.Errorf("Expected size to shrink after delete: %+v", stats)
+	}
+}
+
+func TestStateManagerEvictionChurn(t *testing.T) {
+	manager := state.NewStateManager(state.WithMaxEntries(100))
+	for i := 0; i < 100; i++ {
+		manager.Set(strconv.Itoa(i), i)
+	}
+	// 覆盖、删除和访问之后，淘汰顺序仍按最近访问时间
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 10; i++ {
+		manager.Set(strconv.Itoa(i), -i)
+		manager.Delete(strconv.Itoa(10 + i))
+		manager.Get(strconv.Itoa(20 + i))
+	}
+	manager.Set("short", "gone", state.WithTTL(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	for i := 100; i < 1000; i++ {
+		manager.Set(strconv.Itoa(i), i)
+	}
+
+	keys := manager.Keys("")
+	if len(keys) != 100 {
+		t.Fatalf("Expected 100 entries, got %d", len(keys))
+	}
+	for _, key := range []string{"0", "9", "20", "29", "short", "30", "899"} {
+		if manager.Exists(key) {
+			t.Errorf("Expected %s to be evicted", key)
+		}
+	}
+	if !manager.Exists("900") || !manager.Exists("999") {
+		t.Error("Expected the newest entries to survive")
+	}
+	if stats := manager.Stats(); stats.Expirations != 1 || stats.Evictions != 890 { // 90 + 900 条，过期 1 条，保留 100 条
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestStateManagerJanitor(t *testing.T) {
+	expired := make(chan string, 4)
+	manager := state.NewStateManager(state.WithJanitor(10*time.Millisecond), state.WithOnExpire(func(key string, value interface{}) {
+		expired <- key
+	}))
+	defer manager.Close()
+
+	manager.Namespace("BTCUSDT").Set("memory", "long", state.WithTTL(20*time.Millisecond))
+	manager.Set("kept", "value")
+
+	select {
+	case key := <-expired:
+		if key != "BTCUSDT/memory" {
+			t.Errorf("Unexpected expired key %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected janitor to remove expired entry")
+	}
+	stats := manager.Stats()
+	if stats.Expirations != 1 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats after janitor: %+v", stats)
+	}
+}
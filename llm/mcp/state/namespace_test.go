@@ -0,0 +1,64 @@
+package state_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+func TestNewStateManagerIsolated(t *testing.T) {
+	a := state.NewStateManager()
+	b := state.NewStateManager()
+	a.Set("memory", "a")
+
+	if b.Exists("memory") {
+		t.Error("Separate managers should not share state")
+	}
+	if a == state.GetInstance() {
+		t.Error("NewStateManager should not return the default instance")
+	}
+}
+
+func TestStateManagerNamespace(t *testing.T) {
+	manager := state.NewStateManager()
+	btc := manager.Namespace("BTCUSDT")
+	eth := manager.Namespace("ETHUSDT")
+
+	btc.Set("memory", "long")
+	eth.Set("memory", "short")
+	btc.Namespace("session1").Set("note", "first")
+	manager.Set("global", 1)
+
+	if v, _ := btc.Get("memory"); v != "long" {
+		t.Errorf("Expected BTC memory, got %v", v)
+	}
+	if v, _ := manager.Get("ETHUSDT/memory"); v != "short" {
+		t.Errorf("Expected namespaced key in root, got %v", v)
+	}
+	if btc.Exists("global") {
+		t.Error("Namespace should not see root keys")
+	}
+	if got := btc.GetAll(); !reflect.DeepEqual(got, map[string]interface{}{"memory": "long", "session1/note": "first"}) {
+		t.Errorf("Unexpected namespace GetAll: %v", got)
+	}
+
+	if got := manager.Keys(""); !reflect.DeepEqual(got, []string{"BTCUSDT/memory", "BTCUSDT/session1/note", "ETHUSDT/memory", "global"}) {
+		t.Errorf("Unexpected root keys: %v", got)
+	}
+	if got := manager.Keys("BTCUSDT/"); !reflect.DeepEqual(got, []string{"BTCUSDT/memory", "BTCUSDT/session1/note"}) {
+		t.Errorf("Unexpected prefixed keys: %v", got)
+	}
+	if got := btc.Keys("sess"); !reflect.DeepEqual(got, []string{"session1/note"}) {
+		t.Errorf("Unexpected namespace keys: %v", got)
+	}
+
+	btc.Clear()
+	if got := manager.Keys(""); !reflect.DeepEqual(got, []string{"ETHUSDT/memory", "global"}) {
+		t.Errorf("Namespace Clear should only remove its own keys: %v", got)
+	}
+	eth.Delete("memory")
+	if manager.Exists("ETHUSDT/memory") {
+		t.Error("Namespace Delete should remove the prefixed key")
+	}
+}
@@ -0,0 +1,430 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Cai-ki/cage/jsondb"
+)
+
+// Record 持久化时单个状态条目的格式，Value 为 JSON 编码后的值
+type Record struct {
+	Key       string          `json:"key"`
+	Type      string          `json:"type"`
+	Value     json.RawMessage `json:"value"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Version   uint64          `json:"version"`
+}
+
+// Store 持久化后端，每次保存完整快照
+type Store interface {
+	Load() ([]Record, error)
+	Save(records []Record) error
+}
+
+// --- 类型注册表 ---
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]func(json.RawMessage) (interface{}, error){}
+)
+
+// RegisterType 注册类型 T，恢复时 Type 与 T 相同的条目会被解码为 T 而不是 map[string]interface{}
+func RegisterType[T any]() {
+	var zero T
+	name := reflect.TypeOf(&zero).Elem().String()
+	RegisterDecoder(name, func(raw json.RawMessage) (interface{}, error) {
+		var v T
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	})
+}
+
+// RegisterDecoder 为 StateEntry.Type 名称注册自定义解码函数
+func RegisterDecoder(typeName string, decode func(json.RawMessage) (interface{}, error)) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[typeName] = decode
+}
+
+func init() {
+	RegisterType[string]()
+	RegisterType[bool]()
+	RegisterType[int]()
+	RegisterType[int64]()
+	RegisterType[float64]()
+	RegisterType[time.Time]()
+	RegisterType[[]string]()
+	RegisterType[[]interface{}]()
+	RegisterType[map[string]string]()
+	RegisterType[map[string]interface{}]()
+}
+
+// decodeValue 按类型名解码，未注册的类型按通用 JSON 解码
+func decodeValue(typeName string, raw json.RawMessage) (interface{}, error) {
+	if typeName == "nil" {
+		return nil, nil
+	}
+	decodersMu.RLock()
+	decode, ok := decoders[typeName]
+	decodersMu.RUnlock()
+	if ok {
+		return decode(raw)
+	}
+	var v interface{}
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// --- 快照与恢复 ---
+
+// Snapshot 导出视图中所有未过期的条目，键不含命名空间前缀，无法编码的值会被跳过并在错误中说明
+func (s *StateManager) Snapshot() ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	records := make([]Record, 0, len(s.states))
+	var errs []error
+	for key, entry := range s.states {
+		key, ok := strings.CutPrefix(key, s.prefix)
+		if !ok {
+			continue
+		}
+		if entry.ExpiresAt != nil && now.After(*entry.ExpiresAt) {
+			continue
+		}
+		data, err := json.Marshal(entry.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("state: cannot persist %q: %w", key, err))
+			continue
+		}
+		records = append(records, Record{
+			Key:       key,
+			Type:      entry.Type,
+			Value:     data,
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.UpdatedAt,
+			ExpiresAt: entry.ExpiresAt,
+			Version:   entry.Version,
+		})
+	}
+	return records, errors.Join(errs...)
+}
+
+// Save 将当前状态保存到 store
+func (s *StateManager) Save(store Store) error {
+	records, snapErr := s.Snapshot()
+	if err := store.Save(records); err != nil {
+		return err
+	}
+	return snapErr
+}
+
+// Restore 从 store 加载状态到视图中，已过期的条目会被丢弃，同名的现有条目会被覆盖
+func (s *StateManager) Restore(store Store) error {
+	records, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs []error
+	s.mu.Lock()
+	for _, r := range records {
+		if r.ExpiresAt != nil && now.After(*r.ExpiresAt) {
+			continue
+		}
+		value, err := decodeValue(r.Type, r.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("state: cannot restore %q as %s: %w", r.Key, r.Type, err))
+			continue
+		}
+		// 保留快照中的类型名，类型尚未注册时值被解码为 map，下次保存仍能写回原来的类型
+		typ := r.Type
+		if typ == "" {
+			typ = getType(value)
+		}
+		entry := &StateEntry{
+			Value:     value,
+			Type:      typ,
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+			ExpiresAt: r.ExpiresAt,
+			Version:   r.Version,
+		}
+		key := s.prefix + r.Key
+		var oldValue interface{}
+		if old, ok := s.states[key]; ok {
+			entry.OnChange = old.OnChange
+			if _, ok := s.live(key); ok {
+				oldValue = old.Value
+			}
+		}
+		s.putLocked(key, entry)
+		s.emitLocked(EventSet, key, oldValue, value, entry.Version)
+	}
+	expired, evicted := s.evictLocked("")
+	s.recordRemoved(expired, evicted)
+	s.changed()
+	s.mu.Unlock()
+
+	s.runCallbacks(expired, evicted)
+	return errors.Join(errs...)
+}
+
+// --- 自动持久化 ---
+
+// PersistOption 自动持久化的可选配置
+type PersistOption func(*persister)
+
+// WithFlushInterval 每隔 d 在状态有变化时保存一次
+func WithFlushInterval(d time.Duration) PersistOption {
+	return func(p *persister) {
+		p.interval = d
+	}
+}
+
+// WithFlushOnChange 每次 Set、Delete、Clear 后都保存（在后台合并连续的修改）
+func WithFlushOnChange() PersistOption {
+	return func(p *persister) {
+		p.onChange = true
+	}
+}
+
+// WithFlushErrorHandler 处理后台保存的错误，默认写入标准日志
+func WithFlushErrorHandler(fn func(error)) PersistOption {
+	return func(p *persister) {
+		p.onError = fn
+	}
+}
+
+type persister struct {
+	store    Store
+	interval time.Duration
+	onChange bool
+	onError  func(error)
+
+	mu      sync.Mutex  // 串行化保存
+	dirty   atomic.Bool // 上次保存后是否有修改
+	notify  chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Persist 从 store 恢复状态并开始自动保存，未指定选项时默认每分钟保存一次
+// 在命名空间视图上调用时只保存该命名空间；同一份数据同时只能有一个自动保存
+// 恢复失败时不会开启自动保存，避免覆盖原有快照；调用 Close 停止自动保存并做最后一次保存
+func (s *StateManager) Persist(store Store, opts ...PersistOption) error {
+	p := &persister{
+		store:   store,
+		notify:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		onError: func(err error) { log.Printf("state: flush failed: %v", err) },
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.interval <= 0 && !p.onChange {
+		p.interval = time.Minute
+	}
+
+	if err := s.stopPersist(); err != nil {
+		return err
+	}
+	if err := s.Restore(store); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.persist = p
+	s.mu.Unlock()
+	go s.flushLoop(p)
+	return nil
+}
+
+// Flush 立即保存一次，未开启自动保存时不做任何事
+func (s *StateManager) Flush() error {
+	s.mu.RLock()
+	p := s.persist
+	s.mu.RUnlock()
+	if p == nil {
+		return nil
+	}
+	return s.flush(p, true)
+}
+
+// stopPersist 停止自动保存并做最后一次保存
+func (s *StateManager) stopPersist() error {
+	s.mu.Lock()
+	p := s.persist
+	s.persist = nil
+	s.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	close(p.stop)
+	<-p.stopped
+	return s.flush(p, true)
+}
+
+// changed 在状态修改后调用，调用方必须持有 s.mu
+func (s *StateManager) changed() {
+	p := s.persist
+	if p == nil {
+		return
+	}
+	// 这里持有 s.mu，不能再获取 p.mu，否则与 flush 的加锁顺序相反
+	p.dirty.Store(true)
+	if p.onChange {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *StateManager) flushLoop(p *persister) {
+	defer close(p.stopped)
+	var tick <-chan time.Time
+	if p.interval > 0 {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-tick:
+		case <-p.notify:
+		}
+		if err := s.flush(p, false); err != nil {
+			p.onError(err)
+		}
+	}
+}
+
+// flush 保存快照，force 为 false 时只在有修改时保存
+func (s *StateManager) flush(p *persister, force bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.dirty.Swap(false) && !force {
+		return nil
+	}
+	err := s.Save(p.store)
+	if err != nil {
+		p.dirty.Store(true)
+	}
+	return err
+}
+
+// --- 内置后端 ---
+
+// FileStore 将快照以 JSON 数组写入单个文件，先写临时文件再替换，避免写到一半时崩溃损坏数据
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore 创建文件快照后端
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load 读取快照，文件不存在时返回空
+func (f *FileStore) Load() ([]Record, error) {
+	data, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("state: corrupt snapshot %s: %w", f.Path, err)
+	}
+	return records, nil
+}
+
+// Save 写入快照
+func (f *FileStore) Save(records []Record) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	// 每次写入唯一的临时文件，多个持久化同一路径时不会互相覆盖
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// CreateTemp 创建的文件只有所有者可读，保持与原来一致的 0644
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// JSONDBStore 将快照作为一条记录存入 jsondb，只保留最新的快照
+type JSONDBStore struct {
+	DB *jsondb.Database
+}
+
+// NewJSONDBStore 创建 jsondb 后端
+func NewJSONDBStore(db *jsondb.Database) *JSONDBStore {
+	return &JSONDBStore{DB: db}
+}
+
+type snapshot struct {
+	Records []Record `json:"records"`
+}
+
+// Load 读取最新的快照
+func (j *JSONDBStore) Load() ([]Record, error) {
+	var latest []snapshot
+	if err := j.DB.GetLatest(1, &latest); err != nil {
+		return nil, err
+	}
+	if len(latest) == 0 {
+		return nil, nil
+	}
+	return latest[0].Records, nil
+}
+
+// Save 追加新快照并删除旧快照
+func (j *JSONDBStore) Save(records []Record) error {
+	before := time.Now()
+	if err := j.DB.Add(snapshot{Records: records}); err != nil {
+		return err
+	}
+	return j.DB.DeleteBefore(before)
+}
@@ -0,0 +1,175 @@
+package state_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/jsondb"
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+type position struct {
+	Symbol   string  `json:"symbol"`
+	Quantity float64 `json:"quantity"`
+}
+
+func TestStateManagerSaveRestore(t *testing.T) {
+	state.RegisterType[position]()
+	state.RegisterType[*position]()
+
+	db, err := jsondb.NewDatabase(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]state.Store{
+		"file":   state.NewFileStore(filepath.Join(t.TempDir(), "snapshot", "state.json")),
+		"jsondb": state.NewJSONDBStore(db),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			manager := state.NewStateManager()
+
+			manager.Set("memory", "long BTC")
+			manager.Set("count", 3)
+			manager.Set("position", position{Symbol: "BTCUSDT", Quantity: 0.01})
+			manager.Set("pointer", &position{Symbol: "ETHUSDT"})
+			manager.Set("untyped", struct{ A int }{1})
+			manager.Set("short", "gone", state.WithTTL(50*time.Millisecond))
+			manager.Set("long", "kept", state.WithTTL(time.Hour))
+
+			if err := manager.Save(store); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			// 第二次保存覆盖旧快照
+			manager.Set("memory", "short BTC")
+			if err := manager.Save(store); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			time.Sleep(60 * time.Millisecond)
+			manager.Clear()
+
+			if err := manager.Restore(store); err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			}
+			if v, _ := manager.Get("memory"); v != "short BTC" {
+				t.Errorf("Expected latest memory, got %v", v)
+			}
+			if v, ok := manager.GetWithType("count", "int"); !ok || v != 3 {
+				t.Errorf("Expected int 3, got %#v", v)
+			}
+			if v, _ := manager.Get("position"); v != (position{Symbol: "BTCUSDT", Quantity: 0.01}) {
+				t.Errorf("Expected typed position, got %#v", v)
+			}
+			if v, _ := manager.Get("pointer"); !reflect.DeepEqual(v, &position{Symbol: "ETHUSDT"}) {
+				t.Errorf("Expected pointer position, got %#v", v)
+			}
+			if v, _ := manager.Get("untyped"); !reflect.DeepEqual(v, map[string]interface{}{"A": float64(1)}) {
+				t.Errorf("Expected generic value for unregistered type, got %#v", v)
+			}
+			if manager.Exists("short") {
+				t.Error("Expired entry should not be restored")
+			}
+			if v, _ := manager.Get("long"); v != "kept" {
+				t.Errorf("Expected unexpired entry, got %v", v)
+			}
+		})
+	}
+}
+
+// lateType 在测试中途才注册
+type lateType struct {
+	N int `json:"n"`
+}
+
+func TestStateManagerRestoreKeepsType(t *testing.T) {
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	manager := state.NewStateManager()
+	manager.Set("late", lateType{N: 1})
+	if err := manager.Save(store); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未注册时恢复为 map，再次保存不能丢失原来的类型名
+	restored := state.NewStateManager()
+	if err := restored.Restore(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Save(store); err != nil {
+		t.Fatal(err)
+	}
+
+	state.RegisterType[lateType]()
+	again := state.NewStateManager()
+	if err := again.Restore(store); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := again.Get("late"); v != (lateType{N: 1}) {
+		t.Errorf("Expected typed value after registering, got %#v", v)
+	}
+}
+
+func TestFileStoreConcurrentSave(t *testing.T) {
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.Save([]state.Record{{Key: "k", Type: "int", Value: []byte(strconv.Itoa(i))}}); err != nil {
+				t.Errorf("Concurrent Save failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if records, err := store.Load(); err != nil || len(records) != 1 {
+		t.Errorf("Expected a valid snapshot, got %v (%v)", records, err)
+	}
+	if tmps, _ := filepath.Glob(store.Path + ".*.tmp"); len(tmps) != 0 {
+		t.Errorf("Expected no leftover temp files, got %v", tmps)
+	}
+}
+
+func TestStateManagerPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := state.NewFileStore(path)
+	manager := state.NewStateManager()
+
+	if err := manager.Persist(store, state.WithFlushOnChange()); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	manager.Set("memory", "long BTC")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "long BTC") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected change to be flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	manager.Set("memory", "short BTC")
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	manager.Clear()
+
+	// 重新开启持久化时从快照恢复
+	if err := manager.Persist(store, state.WithFlushInterval(time.Hour)); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	defer manager.Close()
+	if v, _ := manager.Get("memory"); v != "short BTC" {
+		t.Errorf("Expected restored memory, got %v", v)
+	}
+}
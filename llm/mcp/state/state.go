@@ -2,14 +2,35 @@ package state
 
 import (
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// NamespaceSeparator 命名空间与键之间的分隔符
+const NamespaceSeparator = "/"
+
 // StateManager 通用状态管理器
+// 通过 Namespace 得到的子视图与父级共享同一份数据，只是所有键都加上了命名空间前缀
 type StateManager struct {
-	mu     sync.RWMutex
-	states map[string]*StateEntry
+	*store
+	prefix string // 命名空间前缀，根实例为空
+}
+
+// store 多个视图共享的底层数据
+type store struct {
+	mu          sync.RWMutex
+	states      map[string]*StateEntry
+	bytes       int64 // 所有条目的估算大小
+	cfg         managerConfig
+	counters    counters
+	janitorStop chan struct{}
+	persist     *persister // 自动持久化，未开启时为 nil
+	watchers    map[*Watcher]struct{}
+	victims     indexHeap // 设置了容量限制时的淘汰索引
+	expiries    indexHeap // 设置了容量限制时带 TTL 条目的过期索引
 }
 
 // StateEntry 状态条目
@@ -19,7 +40,12 @@ type StateEntry struct {
 	CreatedAt time.Time                  `json:"created_at"`
 	UpdatedAt time.Time                  `json:"updated_at"`
 	ExpiresAt *time.Time                 `json:"expires_at,omitempty"`
+	Version   uint64                     `json:"version"` // 每次写入加一，用于 CompareAndSwap
 	OnChange  func(old, new interface{}) `json:"-"`
+
+	size     int64         // 键和值的估算大小
+	accessed atomic.Int64  // 最近访问时间（UnixNano），用于 LRU
+	hits     atomic.Uint64 // 访问次数，用于 LFU
 }
 
 var (
@@ -27,21 +53,68 @@ var (
 	once     sync.Once
 )
 
-// GetInstance 返回单例实例
+// GetInstance 返回进程级的默认实例，后台每分钟清理一次过期条目
 func GetInstance() *StateManager {
 	once.Do(func() {
-		instance = &StateManager{
-			states: make(map[string]*StateEntry),
-		}
+		instance = NewStateManager(WithJanitor(DefaultJanitorInterval))
 	})
 	return instance
 }
 
-// Set 设置状态值 - 修复版本
+// NewStateManager 创建独立的状态管理器，与默认实例互不影响
+// 使用 WithJanitor 等选项时，不再使用后应调用 Close 停止后台任务
+func NewStateManager(opts ...ManagerOption) *StateManager {
+	s := &StateManager{store: &store{states: make(map[string]*StateEntry)}}
+	for _, opt := range opts {
+		opt(&s.cfg)
+	}
+	if s.cfg.janitor > 0 {
+		s.startJanitor(s.cfg.janitor)
+	}
+	return s
+}
+
+// Namespace 返回命名空间子视图，例如 sm.Namespace("BTCUSDT") 中的 "memory" 实际存为 "BTCUSDT/memory"
+// 子视图可以继续嵌套，多个 agent 或交易对可以各自使用独立的命名空间
+func (s *StateManager) Namespace(name string) *StateManager {
+	return &StateManager{store: s.store, prefix: s.prefix + name + NamespaceSeparator}
+}
+
+// Prefix 返回视图的完整键前缀，根实例为空
+func (s *StateManager) Prefix() string {
+	return s.prefix
+}
+
+// Keys 按字典序返回视图中以 prefix 开头且未过期的键（不含命名空间前缀），prefix 为空时返回全部
+func (s *StateManager) Keys(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var keys []string
+	for key, entry := range s.states {
+		rel, ok := strings.CutPrefix(key, s.prefix)
+		if !ok || !strings.HasPrefix(rel, prefix) {
+			continue
+		}
+		if entry.ExpiresAt != nil && now.After(*entry.ExpiresAt) {
+			continue
+		}
+		keys = append(keys, rel)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set 设置状态值
 func (s *StateManager) Set(key string, value interface{}, options ...StateOption) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.setLocked(s.prefix+key, value, options)
+}
 
+// setLocked 写入条目并递增版本号，调用方必须持有写锁，key 为包含前缀的完整键
+func (s *StateManager) setLocked(key string, value interface{}, options []StateOption) *StateEntry {
 	now := time.Now()
 
 	// 创建新条目
@@ -50,15 +123,21 @@ func (s *StateManager) Set(key string, value interface{}, options ...StateOption
 		Type:      getType(value),
 		CreatedAt: now,
 		UpdatedAt: now,
+		Version:   1,
 	}
 
-	// 获取旧值（如果存在）
-	var oldValue interface{}
+	// 获取旧值（如果存在），已过期的旧值不作为事件中的 Old
+	var oldValue, eventOld interface{}
 	oldEntry, exists := s.states[key]
 	if exists {
 		oldValue = oldEntry.Value
+		if _, ok := s.live(key); ok {
+			eventOld = oldValue
+		}
 		entry.CreatedAt = oldEntry.CreatedAt
 		entry.OnChange = oldEntry.OnChange
+		entry.Version = oldEntry.Version + 1
+		entry.hits.Store(oldEntry.hits.Load())
 	}
 
 	// 应用选项
@@ -66,8 +145,15 @@ func (s *StateManager) Set(key string, value interface{}, options ...StateOption
 		option(entry)
 	}
 
-	// 先保存新状态
-	s.states[key] = entry
+	// 先保存新状态，超出容量时淘汰其他条目
+	s.putLocked(key, entry)
+	s.emitLocked(EventSet, key, eventOld, value, entry.Version)
+	expired, evicted := s.evictLocked(key)
+	s.recordRemoved(expired, evicted)
+	s.changed()
+	if len(expired) > 0 || len(evicted) > 0 {
+		go s.runCallbacks(expired, evicted)
+	}
 
 	// 然后在锁外调用回调（避免死锁）
 	if exists && entry.OnChange != nil {
@@ -76,6 +162,16 @@ func (s *StateManager) Set(key string, value interface{}, options ...StateOption
 			entry.OnChange(oldVal, newVal)
 		}(oldValue, value)
 	}
+	return entry
+}
+
+// live 返回未过期的条目，调用方必须持有锁，key 为包含前缀的完整键
+func (s *StateManager) live(key string) (*StateEntry, bool) {
+	entry, exists := s.states[key]
+	if !exists || (entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt)) {
+		return nil, false
+	}
+	return entry, true
 }
 
 // Get 获取状态值
@@ -83,16 +179,13 @@ func (s *StateManager) Get(key string) (interface{}, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	entry, exists := s.states[key]
+	entry, exists := s.live(s.prefix + key)
 	if !exists {
+		s.counters.misses.Add(1)
 		return nil, false
 	}
-
-	// 检查过期
-	if entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt) {
-		return nil, false
-	}
-
+	s.counters.hits.Add(1)
+	entry.touch()
 	return entry.Value, true
 }
 
@@ -115,7 +208,10 @@ func (s *StateManager) GetWithType(key string, expectedType string) (interface{}
 func (s *StateManager) Delete(key string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.states, key)
+	if entry, ok := s.removeLocked(s.prefix + key); ok {
+		s.emitLocked(EventDelete, s.prefix+key, entry.Value, nil, entry.Version)
+	}
+	s.changed()
 }
 
 // Exists 检查状态是否存在
@@ -123,19 +219,11 @@ func (s *StateManager) Exists(key string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	entry, exists := s.states[key]
-	if !exists {
-		return false
-	}
-
-	if entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt) {
-		return false
-	}
-
-	return true
+	_, exists := s.live(s.prefix + key)
+	return exists
 }
 
-// GetAll 获取所有状态
+// GetAll 获取视图中的所有状态，键不含命名空间前缀
 func (s *StateManager) GetAll() map[string]interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -144,38 +232,60 @@ func (s *StateManager) GetAll() map[string]interface{} {
 	now := time.Now()
 
 	for key, entry := range s.states {
+		rel, ok := strings.CutPrefix(key, s.prefix)
+		if !ok {
+			continue
+		}
 		if entry.ExpiresAt != nil && now.After(*entry.ExpiresAt) {
 			continue
 		}
-		result[key] = entry.Value
+		result[rel] = entry.Value
 	}
 
 	return result
 }
 
-// Cleanup 清理过期状态
+// Cleanup 清理视图中的过期状态，返回清理的条目数
 func (s *StateManager) Cleanup() int {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	count := 0
+	var expired []removed
 	now := time.Now()
-
 	for key, entry := range s.states {
+		if !s.inView(key) {
+			continue
+		}
 		if entry.ExpiresAt != nil && now.After(*entry.ExpiresAt) {
-			delete(s.states, key)
-			count++
+			s.removeLocked(key)
+			expired = append(expired, removed{key, entry.Value, entry.Version})
 		}
 	}
+	if len(expired) > 0 {
+		s.recordRemoved(expired, nil)
+		s.changed()
+	}
+	s.mu.Unlock()
 
-	return count
+	s.runCallbacks(expired, nil)
+	return len(expired)
 }
 
-// Clear 清空所有状态（用于测试）
+// Clear 清空视图中的所有状态，根实例会清空全部数据
 func (s *StateManager) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.states = make(map[string]*StateEntry)
+	if s.prefix == "" && len(s.watchers) == 0 {
+		s.states = make(map[string]*StateEntry)
+		s.bytes = 0
+		s.victims, s.expiries = nil, nil
+	} else {
+		for key, entry := range s.states {
+			if s.inView(key) {
+				s.removeLocked(key)
+				s.emitLocked(EventDelete, key, entry.Value, nil, entry.Version)
+			}
+		}
+	}
+	s.changed()
 }
 
 // StateOption 状态选项函数
@@ -189,7 +299,8 @@ func WithTTL(ttl time.Duration) StateOption {
 	}
 }
 
-// WithOnChange 设置变更回调
+// WithOnChange 设置变更回调，只在覆盖已有的键时触发，每次在新的协程中调用，不保证顺序
+// 需要按顺序接收写入、删除和过期事件时使用 Watch
 func WithOnChange(callback func(old, new interface{})) StateOption {
 	return func(entry *StateEntry) {
 		entry.OnChange = callback
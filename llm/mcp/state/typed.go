@@ -0,0 +1,66 @@
+package state
+
+// Get 以类型 T 读取状态值，不存在、已过期或类型不匹配时返回零值和 false
+// sm 为 nil 时使用默认实例
+func Get[T any](sm *StateManager, key string) (T, bool) {
+	if sm == nil {
+		sm = GetInstance()
+	}
+	var zero T
+	value, ok := sm.Get(key)
+	if !ok {
+		return zero, false
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+	return typed, true
+}
+
+// Update 原子地读取并写入状态值，返回写入的新值
+// fn 收到旧值和是否存在（不存在、已过期或类型不匹配时 ok 为 false），在锁内执行，不能再调用同一个 StateManager
+func Update[T any](sm *StateManager, key string, fn func(old T, ok bool) T, options ...StateOption) T {
+	if sm == nil {
+		sm = GetInstance()
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var old T
+	ok := false
+	if entry, exists := sm.live(sm.prefix + key); exists {
+		old, ok = entry.Value.(T)
+	}
+	value := fn(old, ok)
+	sm.setLocked(sm.prefix+key, value, options)
+	return value
+}
+
+// GetVersioned 读取状态值及其版本号，用于之后的 CompareAndSwap
+func (s *StateManager) GetVersioned(key string) (interface{}, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, exists := s.live(s.prefix + key)
+	if !exists {
+		return nil, 0, false
+	}
+	return entry.Value, entry.Version, true
+}
+
+// CompareAndSwap 仅当当前版本号等于 version 时写入 value，返回是否写入成功
+// version 为 0 表示只在键不存在（或已过期）时写入
+func (s *StateManager) CompareAndSwap(key string, version uint64, value interface{}, options ...StateOption) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current uint64
+	if entry, exists := s.live(s.prefix + key); exists {
+		current = entry.Version
+	}
+	if current != version {
+		return false
+	}
+	s.setLocked(s.prefix+key, value, options)
+	return true
+}
@@ -0,0 +1,84 @@
+package state_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+func TestTypedGet(t *testing.T) {
+	manager := state.NewStateManager()
+	manager.Set("count", 3)
+	manager.Set("name", "btc")
+
+	if v, ok := state.Get[int](manager, "count"); !ok || v != 3 {
+		t.Errorf("Expected 3, got %v %v", v, ok)
+	}
+	if v, ok := state.Get[int](manager, "name"); ok || v != 0 {
+		t.Errorf("Expected type mismatch, got %v %v", v, ok)
+	}
+	if _, ok := state.Get[string](manager, "missing"); ok {
+		t.Error("Expected missing key")
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	manager := state.NewStateManager().Namespace("agent")
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state.Update(manager, "counter", func(old int, ok bool) int {
+				return old + 1
+			})
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := state.Get[int](manager, "counter"); v != 100 {
+		t.Errorf("Expected 100 after concurrent updates, got %d", v)
+	}
+	if _, version, _ := manager.GetVersioned("counter"); version != 100 {
+		t.Errorf("Expected version 100, got %d", version)
+	}
+
+	// 类型不匹配时 ok 为 false
+	manager.Set("memory", 1)
+	got := state.Update(manager, "memory", func(old string, ok bool) string {
+		if ok {
+			t.Error("Expected ok=false for mismatched type")
+		}
+		return "fresh"
+	})
+	if got != "fresh" {
+		t.Errorf("Unexpected update result %q", got)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	manager := state.NewStateManager()
+
+	if !manager.CompareAndSwap("lock", 0, "agent-a") {
+		t.Fatal("Expected CAS on missing key with version 0 to succeed")
+	}
+	if manager.CompareAndSwap("lock", 0, "agent-b") {
+		t.Error("Expected CAS with version 0 to fail on existing key")
+	}
+
+	value, version, ok := manager.GetVersioned("lock")
+	if !ok || value != "agent-a" || version != 1 {
+		t.Fatalf("Unexpected versioned entry: %v %d %v", value, version, ok)
+	}
+	manager.Set("lock", "agent-c")
+	if manager.CompareAndSwap("lock", version, "agent-b") {
+		t.Error("Expected CAS with stale version to fail")
+	}
+	if !manager.CompareAndSwap("lock", version+1, "agent-b") {
+		t.Error("Expected CAS with current version to succeed")
+	}
+	if v, _ := manager.Get("lock"); v != "agent-b" {
+		t.Errorf("Expected agent-b, got %v", v)
+	}
+}
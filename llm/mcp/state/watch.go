@@ -0,0 +1,228 @@
+package state
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchBuffer 每个订阅默认最多缓存的未读事件数
+const DefaultWatchBuffer = 16
+
+// EventType 状态变更事件类型
+type EventType int
+
+const (
+	EventSet    EventType = iota // 写入，包括新建和覆盖
+	EventDelete                  // Delete 或 Clear 删除
+	EventExpire                  // 过期后被清理
+	EventEvict                   // 超出容量被淘汰
+)
+
+// String 返回事件类型名称
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	}
+	return "unknown"
+}
+
+// Event 状态变更事件
+// Key 不含 Watch 所在视图的命名空间前缀；Old 为变更前的值，新建时为 nil；New 只在 EventSet 时有值
+type Event struct {
+	Type    EventType   `json:"type"`
+	Key     string      `json:"key"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Version uint64      `json:"version"`
+	Time    time.Time   `json:"time"`
+}
+
+// WatchOption Watch 的可选配置
+type WatchOption func(*Watcher)
+
+// WithWatchBuffer 设置最多缓存的未读事件数，默认 DefaultWatchBuffer，小于 1 时按 1 处理
+// 缓存已满时丢弃最旧的事件，丢弃的数量可以通过 Dropped 查询
+func WithWatchBuffer(n int) WatchOption {
+	return func(w *Watcher) {
+		w.buffer = n
+	}
+}
+
+// Watcher 状态变更订阅，事件按发生顺序从 C 中读出
+// 事件先进入容量有限的内部队列，由每个订阅唯一的投递协程按顺序写入 C，读得慢不会阻塞写入方；
+// 队列满时丢弃最旧的事件。不再使用时应调用 Close
+type Watcher struct {
+	// C 接收事件，Close 后被关闭
+	C <-chan Event
+
+	s      *StateManager
+	key    string // 包含命名空间前缀的完整键或前缀
+	prefix bool
+	buffer int
+
+	mu        sync.Mutex
+	queue     []Event
+	dropped   uint64
+	notify    chan struct{}
+	done      chan struct{} // Close：丢弃队列并退出
+	stopped   chan struct{} // Stop：投递完队列后退出
+	unsubOnce sync.Once
+	closeOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// Watch 订阅视图中的状态变更，keyOrPrefix 以 "*" 结尾时匹配该前缀下的所有键，"" 或 "*" 匹配整个视图
+// 例如 Watch("memory") 只订阅 memory，Watch("BTCUSDT/*") 订阅 BTCUSDT 命名空间下的所有键
+func (s *StateManager) Watch(keyOrPrefix string, opts ...WatchOption) *Watcher {
+	w := &Watcher{
+		s:       s,
+		buffer:  DefaultWatchBuffer,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	key, prefix := strings.CutSuffix(keyOrPrefix, "*")
+	w.key = s.prefix + key
+	w.prefix = prefix || keyOrPrefix == ""
+	if w.buffer < 1 {
+		w.buffer = 1
+	}
+	out := make(chan Event)
+	w.C = out
+
+	s.mu.Lock()
+	if s.watchers == nil {
+		s.watchers = make(map[*Watcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+
+	go w.deliver(out)
+	return w
+}
+
+// Close 取消订阅并关闭 C，队列中尚未投递的事件会被丢弃，可重复调用
+func (w *Watcher) Close() {
+	w.unsubscribe()
+	w.closeOnce.Do(func() { close(w.done) })
+}
+
+// Stop 取消订阅，不再接收新的事件，队列中已有的事件投递完后关闭 C，可重复调用
+// 用于退出前处理完所有变更：调用 Stop 后读取 C 直到关闭；订阅方不再读取时应调用 Close
+func (w *Watcher) Stop() {
+	w.unsubscribe()
+	w.stopOnce.Do(func() { close(w.stopped) })
+}
+
+func (w *Watcher) unsubscribe() {
+	w.unsubOnce.Do(func() {
+		w.s.mu.Lock()
+		delete(w.s.watchers, w)
+		w.s.mu.Unlock()
+	})
+}
+
+// match 判断完整键是否属于订阅范围
+func (w *Watcher) match(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// Dropped 返回因队列已满被丢弃的事件数
+func (w *Watcher) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// push 将事件加入队列，不会阻塞，队列已满时丢弃最旧的事件
+func (w *Watcher) push(ev Event) {
+	w.mu.Lock()
+	if len(w.queue) >= w.buffer {
+		w.queue[0] = Event{}
+		w.queue = w.queue[1:]
+		w.dropped++
+	}
+	w.queue = append(w.queue, ev)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver 按顺序将队列中的事件写入 out，直到 Close，或 Stop 后队列为空
+func (w *Watcher) deliver(out chan<- Event) {
+	defer close(out)
+	for {
+		stopping := false
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		case <-w.stopped:
+			// 已取消订阅，队列不会再增长
+			stopping = true
+		}
+		if !w.flush(out) || stopping {
+			return
+		}
+	}
+}
+
+// flush 投递队列中的所有事件，Close 时返回 false
+func (w *Watcher) flush(out chan<- Event) bool {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.queue = nil
+			w.mu.Unlock()
+			return true
+		}
+		ev := w.queue[0]
+		w.queue[0] = Event{}
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		select {
+		case out <- ev:
+		case <-w.done:
+			return false
+		}
+	}
+}
+
+// emitLocked 将事件分发给匹配的订阅，key 为包含前缀的完整键，调用方必须持有写锁
+// 所有修改都在写锁内分发，因此同一个订阅收到的事件顺序与修改顺序一致
+func (s *store) emitLocked(typ EventType, key string, old, new interface{}, version uint64) {
+	if len(s.watchers) == 0 {
+		return
+	}
+	now := time.Now()
+	for w := range s.watchers {
+		if !w.match(key) {
+			continue
+		}
+		w.push(Event{
+			Type:    typ,
+			Key:     strings.TrimPrefix(key, w.s.prefix),
+			Old:     old,
+			New:     new,
+			Version: version,
+			Time:    now,
+		})
+	}
+}
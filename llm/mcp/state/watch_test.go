@@ -0,0 +1,145 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cai-ki/cage/llm/mcp/state"
+)
+
+func nextEvent(t *testing.T, w *state.Watcher) state.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-w.C:
+		if !ok {
+			t.Fatal("Watcher channel closed unexpectedly")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("Expected event within 1 second")
+	}
+	return state.Event{}
+}
+
+func TestStateManagerWatchKey(t *testing.T) {
+	manager := state.NewStateManager()
+	w := manager.Watch("memory", state.WithWatchBuffer(101))
+	defer w.Close()
+
+	// 订阅方不读取时写入也不会阻塞，事件按顺序排队
+	for i := 1; i <= 100; i++ {
+		manager.Set("memory", i)
+		manager.Set("other", i)
+	}
+	manager.Delete("memory")
+
+	for i := 1; i <= 100; i++ {
+		ev := nextEvent(t, w)
+		if ev.Type != state.EventSet || ev.Key != "memory" || ev.New != i || ev.Version != uint64(i) {
+			t.Fatalf("Unexpected event %d: %+v", i, ev)
+		}
+		if i == 1 && ev.Old != nil {
+			t.Errorf("Expected nil old value for new key, got %v", ev.Old)
+		}
+		if i > 1 && ev.Old != i-1 {
+			t.Errorf("Expected old value %d, got %v", i-1, ev.Old)
+		}
+	}
+	if ev := nextEvent(t, w); ev.Type != state.EventDelete || ev.Old != 100 || ev.New != nil {
+		t.Errorf("Unexpected delete event: %+v", ev)
+	}
+	if n := w.Dropped(); n != 0 {
+		t.Errorf("Expected no dropped events, got %d", n)
+	}
+}
+
+func TestStateManagerWatchOverflow(t *testing.T) {
+	manager := state.NewStateManager()
+	w := manager.Watch("memory", state.WithWatchBuffer(3))
+	defer w.Close()
+
+	// 订阅方不读取时队列不会无限增长，只保留最新的事件
+	for i := 1; i <= 100; i++ {
+		manager.Set("memory", i)
+	}
+	var got []interface{}
+	for len(got) == 0 || got[len(got)-1] != 100 {
+		got = append(got, nextEvent(t, w).New)
+	}
+	// 投递协程可能已取出一个较早的事件等待写入 C，其余为最新的 3 个
+	n := len(got)
+	if n < 3 || n > 4 || got[n-3] != 98 || got[n-2] != 99 {
+		t.Errorf("Expected the newest events, got %v", got)
+	}
+	if dropped := w.Dropped(); dropped != uint64(100-n) {
+		t.Errorf("Expected %d dropped events, got %d", 100-n, dropped)
+	}
+}
+
+func TestStateManagerWatchPrefix(t *testing.T) {
+	manager := state.NewStateManager(state.WithMaxEntries(2))
+	btc := manager.Namespace("BTCUSDT")
+	w := manager.Watch("BTCUSDT/*")
+	defer w.Close()
+	nsWatcher := btc.Watch("")
+	defer nsWatcher.Close()
+
+	btc.Set("short", "gone", state.WithTTL(20*time.Millisecond))
+	manager.Set("ETHUSDT/memory", "ignored")
+	time.Sleep(30 * time.Millisecond)
+	btc.Cleanup()
+	btc.Set("a", 1)
+	btc.Set("b", 2)
+	btc.Set("c", 3) // 超出容量，淘汰 ETHUSDT/memory 或 a
+	btc.Clear()
+
+	want := []struct {
+		typ state.EventType
+		key string
+	}{
+		{state.EventSet, "BTCUSDT/short"},
+		{state.EventExpire, "BTCUSDT/short"},
+		{state.EventSet, "BTCUSDT/a"},
+		{state.EventSet, "BTCUSDT/b"},
+		{state.EventSet, "BTCUSDT/c"},
+	}
+	for _, exp := range want {
+		ev := nextEvent(t, w)
+		if ev.Type == state.EventEvict {
+			ev = nextEvent(t, w)
+		}
+		if ev.Type != exp.typ || ev.Key != exp.key {
+			t.Fatalf("Expected %s %s, got %s %s", exp.typ, exp.key, ev.Type, ev.Key)
+		}
+	}
+
+	// 命名空间视图上的订阅收到的键不含前缀
+	if ev := nextEvent(t, nsWatcher); ev.Key != "short" || ev.New != "gone" {
+		t.Errorf("Expected relative key in namespace watcher, got %+v", ev)
+	}
+
+	w.Close()
+	for range w.C {
+		// Close 后通道被关闭，未读事件被丢弃
+	}
+}
+
+func TestStateManagerWatchStop(t *testing.T) {
+	manager := state.NewStateManager()
+	w := manager.Watch("")
+	for i := 0; i < 10; i++ {
+		manager.Set("memory", i)
+	}
+
+	// Stop 后不再接收新事件，但已排队的事件都会投递
+	w.Stop()
+	manager.Set("memory", "after stop")
+	var got []interface{}
+	for ev := range w.C {
+		got = append(got, ev.New)
+	}
+	if len(got) != 10 || got[9] != 9 {
+		t.Errorf("Expected the 10 queued events, got %v", got)
+	}
+	w.Close()
+}
@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const ollamaBaseURL = "http://localhost:11434"
+
+// OllamaProvider talks to Ollama's native /api/chat and /api/embed endpoints.
+type OllamaProvider struct {
+	BaseURL    string
+	HTTPClient *http.Client // nil means http.DefaultClient
+}
+
+// NewOllamaProvider creates an adapter; an empty baseURL uses the local default.
+// A trailing "/v1" (the OpenAI-compatible path) is removed.
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = ollamaBaseURL
+	}
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	return &OllamaProvider{BaseURL: baseURL}
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // an object, not a string
+	} `json:"function"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"` // base64 without data URL prefix
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []any           `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message ollamaMessage `json:"message"`
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, params openai.ChatCompletionNewParams) (openai.ChatCompletionMessage, error) {
+	req, err := parseChatRequest(params)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+
+	oreq := ollamaRequest{Model: req.Model, Options: map[string]any{}}
+	if req.Temperature != nil {
+		oreq.Options["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		oreq.Options["top_p"] = *req.TopP
+	}
+	if req.Seed != nil {
+		oreq.Options["seed"] = *req.Seed
+	}
+	if n := max(req.MaxTokens, req.MaxCompletionTokens); n > 0 {
+		oreq.Options["num_predict"] = n
+	}
+	if stops := req.stops(); len(stops) > 0 {
+		oreq.Options["stop"] = stops
+	}
+	// Ollama has no tool_choice; "none" is honoured by not offering tools
+	for _, t := range req.Tools {
+		if mode, _ := req.toolChoice(); mode == "none" {
+			break
+		}
+		oreq.Tools = append(oreq.Tools, map[string]any{"type": "function", "function": t.Function})
+	}
+
+	for _, m := range req.Messages {
+		om := ollamaMessage{Role: m.Role}
+		if om.Role == "developer" {
+			om.Role = "system"
+		}
+		for _, part := range m.parts() {
+			switch part.Type {
+			case "text":
+				om.Content += part.Text
+			case "image_url":
+				_, data, ok := splitDataURL(part.ImageURL.URL)
+				if !ok {
+					return openai.ChatCompletionMessage{}, fmt.Errorf("llm: ollama only accepts inline images, got %.40s", part.ImageURL.URL)
+				}
+				om.Images = append(om.Images, data)
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = json.RawMessage(tc.Function.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		oreq.Messages = append(oreq.Messages, om)
+	}
+
+	var resp ollamaResponse
+	if err := postJSON(ctx, p.HTTPClient, p.BaseURL+"/api/chat", nil, oreq, &resp); err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+
+	// Ollama does not assign tool call IDs
+	var calls []ToolCall
+	for i, tc := range resp.Message.ToolCalls {
+		calls = append(calls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      tc.Function.Name,
+			Arguments: string(tc.Function.Arguments),
+		})
+	}
+	return assistantMessage(resp.Message.Content, calls)
+}
+
+func (p *OllamaProvider) Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error) {
+	body := map[string]any{"model": model, "input": inputs}
+	if dimensions > 0 {
+		body["dimensions"] = dimensions
+	}
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := postJSON(ctx, p.HTTPClient, p.BaseURL+"/api/embed", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(inputs) {
+		return nil, ErrUnexpectedResponse
+	}
+	return resp.Embeddings, nil
+}
@@ -0,0 +1,454 @@
+package llm
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// PromptVar declares a template variable. Type is one of string, number,
+// int, bool, list, map or any.
+type PromptVar struct {
+	Name     string
+	Type     string
+	Optional bool
+}
+
+// PromptTemplate is one version of a named prompt.
+type PromptTemplate struct {
+	Name        string
+	Version     string
+	Tags        []string
+	Description string
+	Vars        []PromptVar
+	Partial     bool   // partials are only included by other templates
+	Text        string // template body without front matter
+	Hash        string // content hash of Text, identifies edits that kept the version
+}
+
+// RenderedPrompt is the output of a render together with what produced it,
+// so results can be attributed to a prompt version.
+type RenderedPrompt struct {
+	Name       string
+	Version    string
+	Hash       string
+	Text       string
+	Vars       map[string]any
+	RenderedAt time.Time
+}
+
+// Ref returns "name@version#hash", suitable for storing next to a result.
+func (r *RenderedPrompt) Ref() string {
+	return r.Name + "@" + r.Version + "#" + r.Hash
+}
+
+// System returns the rendered text as a system message.
+func (r *RenderedPrompt) System() MessageFunc {
+	return SystemMessage(r.Text)
+}
+
+// User returns the rendered text as a user message.
+func (r *RenderedPrompt) User() MessageFunc {
+	return UserMessage(r.Text)
+}
+
+// PromptRegistry holds versioned prompt templates and the partials they include.
+type PromptRegistry struct {
+	mu       sync.RWMutex
+	prompts  map[string]map[string]*PromptTemplate // name -> version -> template
+	active   map[string]string                     // name -> pinned version
+	onRender []func(*RenderedPrompt)
+}
+
+// NewPromptRegistry creates an empty registry.
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{
+		prompts: make(map[string]map[string]*PromptTemplate),
+		active:  make(map[string]string),
+	}
+}
+
+var defaultPrompts = NewPromptRegistry()
+
+// DefaultPrompts returns the package-level registry.
+func DefaultPrompts() *PromptRegistry {
+	return defaultPrompts
+}
+
+// ParsePrompt parses a template file. The file may start with front matter:
+//
+//	---
+//	name: trading_step
+//	version: 3
+//	tags: stable, short-term
+//	description: futures trading decision
+//	vars: symbol string, price number, memory string?
+//	partial: false
+//	---
+//	Trade {{.symbol}} at {{.price}}. {{template "risk_rules" .}}
+//
+// A trailing "?" marks an optional variable. Without a name, fallback is used.
+func ParsePrompt(fallback string, data string) (*PromptTemplate, error) {
+	p := &PromptTemplate{Name: fallback, Version: "1"}
+	body := data
+
+	if strings.HasPrefix(data, "---\n") || strings.HasPrefix(data, "---\r\n") {
+		rest := data[strings.Index(data, "\n")+1:]
+		end := strings.Index(rest, "\n---")
+		if end < 0 {
+			return nil, fmt.Errorf("prompt %s: unterminated front matter", fallback)
+		}
+		body = strings.TrimLeft(rest[end+len("\n---"):], "\r\n")
+
+		scanner := bufio.NewScanner(strings.NewReader(rest[:end]))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("prompt %s: invalid front matter line %q", fallback, line)
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "name":
+				p.Name = value
+			case "version":
+				p.Version = value
+			case "description":
+				p.Description = value
+			case "tags":
+				p.Tags = splitList(value)
+			case "partial":
+				p.Partial = value == "true"
+			case "vars":
+				for _, decl := range splitList(value) {
+					v, err := parsePromptVar(decl)
+					if err != nil {
+						return nil, fmt.Errorf("prompt %s: %w", fallback, err)
+					}
+					p.Vars = append(p.Vars, v)
+				}
+			default:
+				return nil, fmt.Errorf("prompt %s: unknown front matter key %q", fallback, key)
+			}
+		}
+	}
+
+	p.Text = body
+	sum := sha256.Sum256([]byte(body))
+	p.Hash = hex.EncodeToString(sum[:])[:8]
+	return p, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func parsePromptVar(decl string) (PromptVar, error) {
+	fields := strings.Fields(decl)
+	v := PromptVar{Type: "any"}
+	switch len(fields) {
+	case 1:
+		v.Name = fields[0]
+	case 2:
+		v.Name, v.Type = fields[0], fields[1]
+	default:
+		return v, fmt.Errorf("invalid variable declaration %q", decl)
+	}
+	if strings.HasSuffix(v.Type, "?") || strings.HasSuffix(v.Name, "?") {
+		v.Optional = true
+		v.Type = strings.TrimSuffix(v.Type, "?")
+		v.Name = strings.TrimSuffix(v.Name, "?")
+	}
+	switch v.Type {
+	case "string", "number", "int", "bool", "list", "map", "any":
+	default:
+		return v, fmt.Errorf("unknown variable type %q", v.Type)
+	}
+	return v, nil
+}
+
+// Register adds a template version, checking that its body parses.
+func (r *PromptRegistry) Register(p *PromptTemplate) error {
+	if p.Name == "" {
+		return fmt.Errorf("prompt without name")
+	}
+	if _, err := template.New(p.Name).Parse(p.Text); err != nil {
+		return fmt.Errorf("prompt %s@%s: %w", p.Name, p.Version, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.prompts[p.Name] == nil {
+		r.prompts[p.Name] = make(map[string]*PromptTemplate)
+	}
+	r.prompts[p.Name][p.Version] = p
+	return nil
+}
+
+// RegisterText parses and registers a template from a string.
+func (r *PromptRegistry) RegisterText(name, data string) error {
+	p, err := ParsePrompt(name, data)
+	if err != nil {
+		return err
+	}
+	return r.Register(p)
+}
+
+// Load registers every .md, .txt and .tmpl file under dir in fsys, which may
+// be an embed.FS or os.DirFS. Files without a name in their front matter are
+// named after the file; files starting with "_" are partials.
+func (r *PromptRegistry) Load(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := path.Ext(p)
+		if ext != ".md" && ext != ".txt" && ext != ".tmpl" {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		base := strings.TrimSuffix(path.Base(p), ext)
+		tpl, err := ParsePrompt(strings.TrimPrefix(base, "_"), string(data))
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(base, "_") {
+			tpl.Partial = true
+		}
+		return r.Register(tpl)
+	})
+}
+
+// SetActive pins the version or tag that Render uses for name. By default the
+// highest version is used.
+func (r *PromptRegistry) SetActive(name, versionOrTag string) error {
+	if _, err := r.Lookup(name + "@" + versionOrTag); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active[name] = versionOrTag
+	return nil
+}
+
+// OnRender registers a hook called after every render, e.g. to log which
+// prompt version produced a trading decision.
+func (r *PromptRegistry) OnRender(fn func(*RenderedPrompt)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onRender = append(r.onRender, fn)
+}
+
+// Versions lists the registered versions of name, lowest first.
+func (r *PromptRegistry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var versions []string
+	for v := range r.prompts[name] {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versionLess(versions[i], versions[j]) })
+	return versions
+}
+
+// Lookup resolves "name", "name@version" or "name@tag" to a template.
+func (r *PromptRegistry) Lookup(ref string) (*PromptTemplate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lookupUnsafe(ref)
+}
+
+func (r *PromptRegistry) lookupUnsafe(ref string) (*PromptTemplate, error) {
+	name, want, pinned := strings.Cut(ref, "@")
+	versions := r.prompts[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("prompt %s not found", name)
+	}
+	if !pinned {
+		want = r.active[name]
+	}
+
+	var best *PromptTemplate
+	for _, p := range versions {
+		if want != "" && p.Version != want && !hasTag(p, want) {
+			continue
+		}
+		if best == nil || versionLess(best.Version, p.Version) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("prompt %s has no version or tag %q", name, want)
+	}
+	return best, nil
+}
+
+func hasTag(p *PromptTemplate, tag string) bool {
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// versionLess compares versions numerically where possible ("v2" < "v10").
+func versionLess(a, b string) bool {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		if errA == nil && errB == nil {
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if pa[i] != pb[i] {
+			return pa[i] < pb[i]
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// Render executes the template selected by ref with vars, after checking
+// them against the declared variables. Partials of every name are available
+// through {{template "partial_name" .}}, in their active version.
+func (r *PromptRegistry) Render(ref string, vars map[string]any) (*RenderedPrompt, error) {
+	r.mu.RLock()
+	p, err := r.lookupUnsafe(ref)
+	if err != nil {
+		r.mu.RUnlock()
+		return nil, err
+	}
+	tmpl := template.New(p.Name).Option("missingkey=error")
+	for name := range r.prompts {
+		if name == p.Name {
+			continue
+		}
+		partial, err := r.lookupUnsafe(name)
+		if err != nil || !partial.Partial {
+			continue
+		}
+		if _, err := tmpl.New(name).Parse(partial.Text); err != nil {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("partial %s: %w", name, err)
+		}
+	}
+	hooks := append([]func(*RenderedPrompt){}, r.onRender...)
+	r.mu.RUnlock()
+
+	vars, err = checkPromptVars(p, vars)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(p.Text); err != nil {
+		return nil, err
+	}
+	var buf strings.Builder
+	if err := tmpl.ExecuteTemplate(&buf, p.Name, vars); err != nil {
+		return nil, fmt.Errorf("render prompt %s@%s: %w", p.Name, p.Version, err)
+	}
+
+	rendered := &RenderedPrompt{
+		Name:       p.Name,
+		Version:    p.Version,
+		Hash:       p.Hash,
+		Text:       strings.TrimSpace(buf.String()),
+		Vars:       vars,
+		RenderedAt: time.Now(),
+	}
+	for _, hook := range hooks {
+		hook(rendered)
+	}
+	return rendered, nil
+}
+
+// checkPromptVars validates vars against the declaration and fills missing
+// optional variables with nil. Templates without declared vars accept anything.
+func checkPromptVars(p *PromptTemplate, vars map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(vars))
+	for k, v := range vars {
+		out[k] = v
+	}
+	if len(p.Vars) == 0 {
+		return out, nil
+	}
+
+	declared := make(map[string]bool, len(p.Vars))
+	for _, v := range p.Vars {
+		declared[v.Name] = true
+		val, ok := out[v.Name]
+		if !ok {
+			if !v.Optional {
+				return nil, fmt.Errorf("prompt %s@%s: missing variable %s", p.Name, p.Version, v.Name)
+			}
+			out[v.Name] = nil
+			continue
+		}
+		if !matchesVarType(v.Type, val) {
+			return nil, fmt.Errorf("prompt %s@%s: variable %s should be %s, got %T", p.Name, p.Version, v.Name, v.Type, val)
+		}
+	}
+	for k := range vars {
+		if !declared[k] {
+			return nil, fmt.Errorf("prompt %s@%s: undeclared variable %s", p.Name, p.Version, k)
+		}
+	}
+	return out, nil
+}
+
+func matchesVarType(typ string, val any) bool {
+	if typ == "any" || val == nil {
+		return true
+	}
+	kind := reflect.TypeOf(val).Kind()
+	switch typ {
+	case "string":
+		return kind == reflect.String
+	case "bool":
+		return kind == reflect.Bool
+	case "int":
+		return kind >= reflect.Int && kind <= reflect.Uint64
+	case "number":
+		return kind >= reflect.Int && kind <= reflect.Float64
+	case "list":
+		return kind == reflect.Slice || kind == reflect.Array
+	case "map":
+		return kind == reflect.Map || kind == reflect.Struct || (kind == reflect.Pointer && reflect.TypeOf(val).Elem().Kind() == reflect.Struct)
+	}
+	return false
+}
+
+// LoadPrompts loads templates into the default registry.
+func LoadPrompts(fsys fs.FS, dir string) error {
+	return defaultPrompts.Load(fsys, dir)
+}
+
+// RenderPrompt renders a template from the default registry.
+func RenderPrompt(ref string, vars map[string]any) (*RenderedPrompt, error) {
+	return defaultPrompts.Render(ref, vars)
+}
@@ -0,0 +1,89 @@
+package llm_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+var promptFS = fstest.MapFS{
+	"prompts/trading_v1.md": {Data: []byte(`---
+name: trading
+version: 1
+tags: stable
+vars: symbol string, price number
+---
+Trade {{.symbol}} at {{.price}}.
+`)},
+	"prompts/trading_v2.md": {Data: []byte(`---
+name: trading
+version: 2
+tags: experiment
+vars: symbol string, price number, memory string?
+---
+Trade {{.symbol}} at {{.price}}. {{template "risk" .}}{{with .memory}} Memory: {{.}}{{end}}
+`)},
+	"prompts/_risk.md":   {Data: []byte(`Never risk more than 2% on {{.symbol}}.`)},
+	"prompts/notes.json": {Data: []byte(`ignored`)},
+}
+
+func TestPromptRegistryRender(t *testing.T) {
+	reg := llm.NewPromptRegistry()
+	if err := reg.Load(promptFS, "prompts"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var rendered []string
+	reg.OnRender(func(p *llm.RenderedPrompt) { rendered = append(rendered, p.Ref()) })
+
+	// 默认使用最高版本
+	p, err := reg.Render("trading", map[string]any{"symbol": "BTCUSDT", "price": 67000.5})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if p.Version != "2" || p.Text != "Trade BTCUSDT at 67000.5. Never risk more than 2% on BTCUSDT." {
+		t.Errorf("Unexpected render %s: %q", p.Version, p.Text)
+	}
+
+	// 按标签选择版本
+	p, err = reg.Render("trading@stable", map[string]any{"symbol": "ETHUSDT", "price": 3000})
+	if err != nil || p.Version != "1" {
+		t.Fatalf("Expected version 1 via tag, got %+v (%v)", p, err)
+	}
+
+	if err := reg.SetActive("trading", "1"); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+	p, _ = reg.Render("trading", map[string]any{"symbol": "ETHUSDT", "price": 3000})
+	if p.Version != "1" {
+		t.Errorf("Expected pinned version 1, got %s", p.Version)
+	}
+
+	if len(rendered) != 3 || !strings.HasPrefix(rendered[0], "trading@2#") {
+		t.Errorf("Unexpected render log: %v", rendered)
+	}
+}
+
+func TestPromptRegistryVarChecks(t *testing.T) {
+	reg := llm.NewPromptRegistry()
+	if err := reg.Load(promptFS, "prompts"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cases := map[string]map[string]any{
+		"missing":    {"symbol": "BTCUSDT"},
+		"wrong type": {"symbol": "BTCUSDT", "price": "high"},
+		"undeclared": {"symbol": "BTCUSDT", "price": 1, "extra": true},
+	}
+	for name, vars := range cases {
+		if _, err := reg.Render("trading", vars); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if got := reg.Versions("trading"); len(got) != 2 || got[0] != "1" {
+		t.Errorf("Unexpected versions: %v", got)
+	}
+}
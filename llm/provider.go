@@ -0,0 +1,293 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// Provider is a chat/embedding backend. Requests and replies use the openai
+// types, so callers and mcp.ExecuteToolCalls work the same with every
+// backend; vision is a chat request with image content parts.
+type Provider interface {
+	Chat(ctx context.Context, params openai.ChatCompletionNewParams) (openai.ChatCompletionMessage, error)
+	Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error)
+}
+
+// WithProvider sends chat and embedding requests through p instead of the
+// backend selected by Config.Provider.
+func WithProvider(p Provider) ClientOption {
+	return func(c *LLMClient) {
+		c.provider = p
+	}
+}
+
+// newProvider builds the backend named by cfg.Provider.
+func newProvider(cfg *Config, client *openai.Client, httpClient *http.Client) (Provider, error) {
+	switch cfg.Provider {
+	case "", "openai":
+		return &OpenAIProvider{client: client}, nil
+	case "anthropic":
+		p := NewAnthropicProvider(cfg.BaseURL, cfg.APIKey)
+		p.HTTPClient = httpClient
+		return p, nil
+	case "ollama":
+		p := NewOllamaProvider(cfg.BaseURL)
+		p.HTTPClient = httpClient
+		return p, nil
+	default:
+		return nil, fmt.Errorf("llm: unknown provider %q", cfg.Provider)
+	}
+}
+
+// OpenAIProvider talks to the OpenAI API or any compatible endpoint.
+type OpenAIProvider struct {
+	client *openai.Client
+}
+
+// NewOpenAIProvider wraps an openai-go client.
+func NewOpenAIProvider(client *openai.Client) *OpenAIProvider {
+	return &OpenAIProvider{client: client}
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, params openai.ChatCompletionNewParams) (openai.ChatCompletionMessage, error) {
+	resp, err := p.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{}, ErrUnexpectedResponse
+	}
+	return resp.Choices[0].Message, nil
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, model string, inputs []string, dimensions int) ([][]float32, error) {
+	params := openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{
+			OfArrayOfStrings: inputs,
+		},
+		Model: model,
+	}
+	if dimensions > 0 {
+		params.Dimensions = openai.Int(int64(dimensions))
+	}
+
+	resp, err := p.client.Embeddings.New(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(inputs) {
+		return nil, ErrUnexpectedResponse
+	}
+
+	// Note: The openai-go SDK returns []float64, convert to []float32 if needed
+	data := resp.Data
+	sort.Slice(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+	vecs := make([][]float32, len(data))
+	for i, d := range data {
+		vec := make([]float32, len(d.Embedding))
+		for j, v := range d.Embedding {
+			vec[j] = float32(v)
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+// chatRequest is the provider-neutral view of ChatCompletionNewParams that
+// the native adapters translate from.
+type chatRequest struct {
+	Model               string        `json:"model"`
+	Messages            []chatMessage `json:"messages"`
+	Tools               []chatTool    `json:"tools"`
+	Temperature         *float64      `json:"temperature"`
+	TopP                *float64      `json:"top_p"`
+	MaxTokens           int           `json:"max_tokens"`
+	MaxCompletionTokens int           `json:"max_completion_tokens"`
+	Seed                *int64        `json:"seed"`
+	Stop                any           `json:"stop"`        // string or []string
+	ToolChoice          any           `json:"tool_choice"` // mode string or named function
+	ParallelToolCalls   *bool         `json:"parallel_tool_calls"`
+}
+
+type chatMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"` // string or content parts
+	ToolCalls  []chatToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+}
+
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatTool struct {
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+type chatPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+func parseChatRequest(params openai.ChatCompletionNewParams) (*chatRequest, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var req chatRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// text returns the message content with all text parts joined.
+func (m chatMessage) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var parts []chatPart
+	json.Unmarshal(m.Content, &parts)
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+// parts returns the content as parts, wrapping plain strings in a text part.
+func (m chatMessage) parts() []chatPart {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		if s == "" {
+			return nil
+		}
+		return []chatPart{{Type: "text", Text: s}}
+	}
+	var parts []chatPart
+	json.Unmarshal(m.Content, &parts)
+	return parts
+}
+
+func (r *chatRequest) stops() []string {
+	switch v := r.Stop.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// toolChoice returns the mode ("auto", "none", "required" or "function") and,
+// for "function", the tool name; an empty mode means unset.
+func (r *chatRequest) toolChoice() (mode, name string) {
+	switch v := r.ToolChoice.(type) {
+	case string:
+		return v, ""
+	case map[string]any:
+		if fn, ok := v["function"].(map[string]any); ok {
+			name, _ = fn["name"].(string)
+			return "function", name
+		}
+	}
+	return "", ""
+}
+
+// splitDataURL splits "data:image/png;base64,xxx" into media type and data.
+func splitDataURL(url string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, true
+}
+
+// assistantMessage builds the openai reply shape from native output.
+func assistantMessage(content string, calls []ToolCall) (openai.ChatCompletionMessage, error) {
+	wire := map[string]any{"role": "assistant", "content": content}
+	if len(calls) > 0 {
+		var tcs []map[string]any
+		for _, tc := range calls {
+			tcs = append(tcs, map[string]any{
+				"id":       tc.ID,
+				"type":     "function",
+				"function": map[string]string{"name": tc.Name, "arguments": tc.Arguments},
+			})
+		}
+		wire["tool_calls"] = tcs
+	}
+	data, err := json.Marshal(wire)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	var msg openai.ChatCompletionMessage
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// postJSON sends body to url and decodes a JSON reply into out.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("llm: %s %s: %s", req.Method, url, strings.TrimSpace(string(respBody)))
+	}
+	return json.Unmarshal(respBody, out)
+}
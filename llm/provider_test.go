@@ -0,0 +1,131 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+	"github.com/openai/openai-go"
+)
+
+const addToolJSON = `[{"type":"function","function":{"name":"add","description":"add two numbers",
+"parameters":{"type":"object","properties":{"a":{"type":"number"},"b":{"type":"number"}},"required":["a","b"]}}}]`
+
+// 带工具调用的多轮对话：system、user、assistant(tool_calls)、两条 tool 结果
+func toolConversation() []llm.AllowedParam {
+	asst := openai.ChatCompletionMessage{}
+	json.Unmarshal([]byte(`{"role":"assistant","content":"","tool_calls":[
+		{"id":"call_1","type":"function","function":{"name":"add","arguments":"{\"a\":1,\"b\":2}"}},
+		{"id":"call_2","type":"function","function":{"name":"add","arguments":"{\"a\":3,\"b\":4}"}}]}`), &asst)
+	return []llm.AllowedParam{
+		llm.SystemMessage("you are a calculator"),
+		llm.UserMessage("add 1+2 and 3+4"),
+		llm.MessageFunc(func() openai.ChatCompletionMessageParamUnion { return asst.ToParam() }),
+		llm.ToolMessage(`{"result":3}`, "call_1"),
+		llm.ToolMessage(`{"result":7}`, "call_2"),
+		llm.ToolsByJson(addToolJSON),
+	}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "secret" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("Unexpected request %s headers=%v", r.URL.Path, r.Header)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[
+			{"type":"text","text":"Let me add again."},
+			{"type":"tool_use","id":"toolu_1","name":"add","input":{"a":10,"b":20}}]}`)
+	}))
+	defer srv.Close()
+
+	client, err := llm.NewClient(&llm.Config{Provider: "anthropic", BaseURL: srv.URL, APIKey: "secret", Model: "claude-test"})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	msg, err := client.CompletionByParams(toolConversation()...)
+	if err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+
+	if msg.Content != "Let me add again." || len(msg.ToolCalls) != 1 {
+		t.Fatalf("Unexpected reply: %+v", msg)
+	}
+	if tc := msg.ToolCalls[0]; tc.ID != "toolu_1" || tc.Function.Name != "add" || tc.Function.Arguments != `{"a":10,"b":20}` {
+		t.Errorf("Unexpected tool call: %+v", tc)
+	}
+
+	if got["system"] != "you are a calculator" || got["max_tokens"] == nil {
+		t.Errorf("System prompt or max_tokens not translated: %v", got)
+	}
+	msgs := got["messages"].([]any)
+	if len(msgs) != 3 {
+		t.Fatalf("Expected user/assistant/user messages, got %d: %v", len(msgs), msgs)
+	}
+	asst := msgs[1].(map[string]any)["content"].([]any)
+	if asst[0].(map[string]any)["type"] != "tool_use" || len(asst) != 2 {
+		t.Errorf("Assistant tool calls not translated: %v", asst)
+	}
+	results := msgs[2].(map[string]any)["content"].([]any)
+	if len(results) != 2 || results[1].(map[string]any)["tool_use_id"] != "call_2" {
+		t.Errorf("Tool results should be merged into one user turn: %v", results)
+	}
+	tools := got["tools"].([]any)
+	if tools[0].(map[string]any)["input_schema"] == nil {
+		t.Errorf("Tool schema not translated: %v", tools)
+	}
+}
+
+func TestOllamaProvider(t *testing.T) {
+	var chat map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			json.NewDecoder(r.Body).Decode(&chat)
+			io.WriteString(w, `{"model":"llama","message":{"role":"assistant","content":"",
+				"tool_calls":[{"function":{"name":"add","arguments":{"a":1,"b":2}}}]},"done":true}`)
+		case "/api/embed":
+			io.WriteString(w, `{"model":"nomic","embeddings":[[0.1,0.2],[0.3,0.4]]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := llm.NewClient(&llm.Config{Provider: "ollama", BaseURL: srv.URL + "/v1", Model: "llama", VisionModel: "llava", EmbedModel: "nomic"})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	msg, err := client.CompletionByParams(toolConversation()...)
+	if err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"a":1,"b":2}` || msg.ToolCalls[0].ID == "" {
+		t.Errorf("Unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	msgs := chat["messages"].([]any)
+	asst := msgs[2].(map[string]any)
+	args := asst["tool_calls"].([]any)[0].(map[string]any)["function"].(map[string]any)["arguments"]
+	if _, ok := args.(map[string]any); !ok || chat["stream"] != false {
+		t.Errorf("Tool call arguments should be sent as an object: %v", asst)
+	}
+
+	if _, err := client.VisionWithParts(llm.TextPart("what?"), llm.ImagePart(image.NewRGBA(image.Rect(0, 0, 2, 2)))); err != nil {
+		t.Fatalf("VisionWithParts failed: %v", err)
+	}
+	user := chat["messages"].([]any)[0].(map[string]any)
+	if chat["model"] != "llava" || len(user["images"].([]any)) != 1 || user["content"] != "what?" {
+		t.Errorf("Image not translated: %v", user)
+	}
+
+	vecs, err := client.EmbeddingBatch([]string{"a", "b"})
+	if err != nil || len(vecs) != 2 || vecs[1][1] != 0.4 {
+		t.Errorf("Unexpected embeddings: %v (%v)", vecs, err)
+	}
+}
@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"math"
+	"sort"
+)
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// either is a zero vector or their lengths differ.
+func CosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
+
+// Normalize returns v scaled to unit length. A zero vector is returned unchanged.
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		copy(out, v)
+		return out
+	}
+	norm := math.Sqrt(sum)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// Match is a search hit: the index into the candidate set and its similarity.
+type Match struct {
+	Index int
+	Score float32
+}
+
+// TopK returns the k candidates most similar to query, best first.
+func TopK(query []float32, candidates [][]float32, k int) []Match {
+	matches := make([]Match, len(candidates))
+	for i, c := range candidates {
+		matches[i] = Match{Index: i, Score: CosineSimilarity(query, c)}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if k >= 0 && k < len(matches) {
+		matches = matches[:k]
+	}
+	return matches
+}
@@ -8,13 +8,15 @@ import (
 	"github.com/openai/openai-go"
 )
 
-func (c *LLMClient) completion(prompt string) (string, error) {
-	msg, err := c.completionByParams(UserMessage(prompt))
+// Completion generates text from a text prompt.
+func (c *LLMClient) Completion(prompt string) (string, error) {
+	msg, err := c.CompletionByParams(UserMessage(prompt))
 	return msg.Content, err
 }
 
-func (c *LLMClient) completionBySystem(prompt string) (string, error) {
-	msg, err := c.completionByParams(SystemMessage(prompt))
+// CompletionBySystem generates text from a system prompt.
+func (c *LLMClient) CompletionBySystem(prompt string) (string, error) {
+	msg, err := c.CompletionByParams(SystemMessage(prompt))
 	return msg.Content, err
 }
 
@@ -38,14 +40,167 @@ func ToolMessage(prompt string, toolCallID string) MessageFunc {
 	}
 }
 
+// NamedUserMessage tags a user message with a participant name.
+func NamedUserMessage(name, prompt string) MessageFunc {
+	return func() openai.ChatCompletionMessageParamUnion {
+		msg := openai.UserMessage(prompt)
+		msg.OfUser.Name = openai.String(name)
+		return msg
+	}
+}
+
+// DeveloperMessage adds instructions for reasoning models that replace the
+// system role with the developer role.
+func DeveloperMessage(prompt string) MessageFunc {
+	return func() openai.ChatCompletionMessageParamUnion {
+		return openai.DeveloperMessage(prompt)
+	}
+}
+
+// AssistantMessage replays a model turn, including the tool calls it made, so
+// the following ToolMessage results have something to answer.
+func AssistantMessage(content string, calls ...ToolCall) MessageFunc {
+	return func() openai.ChatCompletionMessageParamUnion {
+		return Message{Role: "assistant", Content: content, ToolCalls: calls}.param()
+	}
+}
+
+// AssistantReply replays a message returned by CompletionByParams.
+func AssistantReply(msg openai.ChatCompletionMessage) MessageFunc {
+	return func() openai.ChatCompletionMessageParamUnion {
+		return msg.ToParam()
+	}
+}
+
+// ContentFunc builds a message whose parts need the client config, e.g. images
+// encoded with the configured detail and size.
+type ContentFunc func(cfg *Config) (openai.ChatCompletionMessageParamUnion, error)
+
+// UserContent sends text and images in one user message.
+func UserContent(parts ...ContentPart) ContentFunc {
+	return func(cfg *Config) (openai.ChatCompletionMessageParamUnion, error) {
+		content, err := contentParts(cfg, parts)
+		if err != nil {
+			return openai.ChatCompletionMessageParamUnion{}, err
+		}
+		return openai.UserMessage(content), nil
+	}
+}
+
 type ToolFunc func() []openai.ChatCompletionToolParam
 
 type AllowedParam interface {
 	Allowed()
 }
 
+// CallOption adjusts a single CompletionByParams call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	bypassCache       bool
+	model             string
+	temperature       *float64
+	maxTokens         int
+	seed              *int64
+	stop              []string
+	toolChoice        string
+	parallelToolCalls *bool
+}
+
+// BypassCache skips the response cache for this call; the fresh reply is not stored.
+func BypassCache() CallOption {
+	return func(o *callOptions) {
+		o.bypassCache = true
+	}
+}
+
+// WithModel overrides Config.Model for this call.
+func WithModel(model string) CallOption {
+	return func(o *callOptions) {
+		o.model = model
+	}
+}
+
+// WithTemperature overrides Config.Temperature for this call.
+func WithTemperature(t float64) CallOption {
+	return func(o *callOptions) {
+		o.temperature = &t
+	}
+}
+
+// WithMaxTokens limits the length of the reply.
+func WithMaxTokens(n int) CallOption {
+	return func(o *callOptions) {
+		o.maxTokens = n
+	}
+}
+
+// WithSeed asks the model for reproducible sampling.
+func WithSeed(seed int64) CallOption {
+	return func(o *callOptions) {
+		o.seed = &seed
+	}
+}
+
+// WithStop ends the reply at any of the given sequences.
+func WithStop(stop ...string) CallOption {
+	return func(o *callOptions) {
+		o.stop = stop
+	}
+}
+
+// WithToolChoice is "auto", "none", "required" or the name of a tool the
+// model must call.
+func WithToolChoice(choice string) CallOption {
+	return func(o *callOptions) {
+		o.toolChoice = choice
+	}
+}
+
+// WithParallelToolCalls allows or forbids several tool calls in one reply.
+func WithParallelToolCalls(enabled bool) CallOption {
+	return func(o *callOptions) {
+		o.parallelToolCalls = &enabled
+	}
+}
+
+// apply copies the per-call overrides into params.
+func (o *callOptions) apply(params *openai.ChatCompletionNewParams) {
+	if o.model != "" {
+		params.Model = o.model
+	}
+	if o.temperature != nil {
+		params.Temperature = openai.Float(*o.temperature)
+	}
+	if o.maxTokens > 0 {
+		params.MaxCompletionTokens = openai.Int(int64(o.maxTokens))
+	}
+	if o.seed != nil {
+		params.Seed = openai.Int(*o.seed)
+	}
+	if len(o.stop) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: o.stop}
+	}
+	switch o.toolChoice {
+	case "":
+	case "auto", "none", "required":
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String(o.toolChoice)}
+	default:
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfChatCompletionNamedToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: o.toolChoice},
+			},
+		}
+	}
+	if o.parallelToolCalls != nil {
+		params.ParallelToolCalls = openai.Bool(*o.parallelToolCalls)
+	}
+}
+
 func (MessageFunc) Allowed() {}
+func (ContentFunc) Allowed() {}
 func (ToolFunc) Allowed()    {}
+func (CallOption) Allowed()  {}
 
 func ToolsByJson(jstr string) ToolFunc {
 	return func() []openai.ChatCompletionToolParam {
@@ -57,15 +212,25 @@ func ToolsByJson(jstr string) ToolFunc {
 	}
 }
 
-func (c *LLMClient) completionByParams(args ...AllowedParam) (openai.ChatCompletionMessage, error) {
+// CompletionByParams sends messages and tools and returns the model message.
+func (c *LLMClient) CompletionByParams(args ...AllowedParam) (openai.ChatCompletionMessage, error) {
 	msgs := []openai.ChatCompletionMessageParamUnion{}
 	tools := []openai.ChatCompletionToolParam{}
+	opts := &callOptions{}
 	for _, arg := range args {
 		switch v := arg.(type) {
 		case MessageFunc:
 			msgs = append(msgs, v())
+		case ContentFunc:
+			msg, err := v(c.cfg)
+			if err != nil {
+				return openai.ChatCompletionMessage{}, err
+			}
+			msgs = append(msgs, msg)
 		case ToolFunc:
 			tools = append(tools, v()...)
+		case CallOption:
+			v(opts)
 		default:
 			return openai.ChatCompletionMessage{}, fmt.Errorf("unsupported argument type: %T", v)
 		}
@@ -78,17 +243,11 @@ func (c *LLMClient) completionByParams(args ...AllowedParam) (openai.ChatComplet
 		Temperature: openai.Float(c.cfg.Temperature),
 		TopP:        openai.Float(c.cfg.TopP),
 	}
+	opts.apply(&params)
 
-	resp, err := c.openai.Chat.Completions.New(
-		context.Background(),
-		params,
-	)
+	return c.guardedChat(params, opts)
+}
 
-	if err != nil {
-		return openai.ChatCompletionMessage{}, err
-	}
-	if len(resp.Choices) == 0 {
-		return openai.ChatCompletionMessage{}, ErrUnexpectedResponse
-	}
-	return resp.Choices[0].Message, nil
+func (c *LLMClient) chat(params openai.ChatCompletionNewParams) (openai.ChatCompletionMessage, error) {
+	return c.provider.Chat(context.Background(), params)
 }
@@ -0,0 +1,100 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+func TestMessageBuildersAndCallOptions(t *testing.T) {
+	fake := llm.NewFake(llm.ReplyText("ok"))
+	client := fake.Client()
+
+	_, err := client.CompletionByParams(
+		llm.DeveloperMessage("be terse"),
+		llm.NamedUserMessage("trader", "add 1+2"),
+		llm.AssistantMessage("", llm.ToolCall{ID: "call_1", Name: "add", Arguments: `{"a":1,"b":2}`}),
+		llm.ToolMessage(`{"result":3}`, "call_1"),
+		llm.UserContent(llm.TextPart("and this chart?"), llm.ImagePart(image.NewRGBA(image.Rect(0, 0, 2, 2)))),
+		llm.ToolsByJson(addToolJSON),
+		llm.WithModel("gpt-override"),
+		llm.WithTemperature(0.2),
+		llm.WithMaxTokens(100),
+		llm.WithSeed(7),
+		llm.WithStop("END"),
+		llm.WithToolChoice("add"),
+		llm.WithParallelToolCalls(false),
+	)
+	if err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+
+	var req struct {
+		Model               string           `json:"model"`
+		Messages            []map[string]any `json:"messages"`
+		Temperature         float64          `json:"temperature"`
+		MaxCompletionTokens int              `json:"max_completion_tokens"`
+		Seed                int              `json:"seed"`
+		Stop                []string         `json:"stop"`
+		ToolChoice          map[string]any   `json:"tool_choice"`
+		ParallelToolCalls   *bool            `json:"parallel_tool_calls"`
+	}
+	if err := fake.Requests()[0].Decode(&req); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if req.Model != "gpt-override" || req.Temperature != 0.2 || req.MaxCompletionTokens != 100 || req.Seed != 7 || req.Stop[0] != "END" {
+		t.Errorf("Call options not applied: %+v", req)
+	}
+	if req.ToolChoice["function"].(map[string]any)["name"] != "add" || req.ParallelToolCalls == nil || *req.ParallelToolCalls {
+		t.Errorf("Tool options not applied: %v %v", req.ToolChoice, req.ParallelToolCalls)
+	}
+
+	roles := []string{}
+	for _, m := range req.Messages {
+		roles = append(roles, m["role"].(string))
+	}
+	if strings.Join(roles, ",") != "developer,user,assistant,tool,user" {
+		t.Fatalf("Unexpected roles: %v", roles)
+	}
+	if req.Messages[1]["name"] != "trader" || req.Messages[2]["tool_calls"] == nil {
+		t.Errorf("Name or tool calls missing: %v", req.Messages[:3])
+	}
+	if parts, ok := req.Messages[4]["content"].([]any); !ok || len(parts) != 2 {
+		t.Errorf("Expected text and image parts: %v", req.Messages[4]["content"])
+	}
+}
+
+func TestAnthropicToolChoice(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, `{"content":[{"type":"text","text":"ok"}]}`)
+	}))
+	defer srv.Close()
+
+	client, err := llm.NewClient(&llm.Config{Provider: "anthropic", BaseURL: srv.URL, Model: "claude-test"})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.CompletionByParams(toolConversation()...); err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+	if got["tool_choice"] != nil {
+		t.Errorf("Expected no tool_choice by default, got %v", got["tool_choice"])
+	}
+
+	params := append(toolConversation(), llm.WithToolChoice("required"), llm.WithParallelToolCalls(false))
+	if _, err := client.CompletionByParams(params...); err != nil {
+		t.Fatalf("CompletionByParams failed: %v", err)
+	}
+	choice := got["tool_choice"].(map[string]any)
+	if choice["type"] != "any" || choice["disable_parallel_tool_use"] != true {
+		t.Errorf("Unexpected tool_choice: %v", choice)
+	}
+}
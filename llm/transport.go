@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+)
+
+// RecordMode selects how a Recorder treats requests.
+type RecordMode string
+
+const (
+	// ModeRecord forwards every request and saves the response as a fixture.
+	ModeRecord RecordMode = "record"
+	// ModeReplay serves fixtures only and never touches the network.
+	ModeReplay RecordMode = "replay"
+	// ModeAuto replays when a fixture exists and records otherwise.
+	ModeAuto RecordMode = "auto"
+)
+
+// Recorder is an http.RoundTripper that saves request/response pairs to
+// fixture files and replays them by request hash, so code that calls the LLM
+// can be tested offline and deterministically.
+type Recorder struct {
+	dir  string
+	mode RecordMode
+	base http.RoundTripper
+}
+
+// NewRecorder creates a Recorder storing fixtures in dir. base performs real
+// requests when recording; nil means http.DefaultTransport.
+func NewRecorder(dir string, mode RecordMode, base http.RoundTripper) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{dir: dir, mode: mode, base: base}
+}
+
+type fixture struct {
+	Request  fixtureRequest  `json:"request"`
+	Response fixtureResponse `json:"response"`
+}
+
+type fixtureRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body"`
+}
+
+type fixtureResponse struct {
+	Status     int               `json:"status"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 []byte            `json:"body_base64,omitempty"` // non-UTF-8 bodies such as audio
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	hash := RequestHash(req.Method, req.URL.Path, req.Header.Get("Content-Type"), body)
+	path := filepath.Join(r.dir, hash+".json")
+
+	if r.mode == ModeReplay || r.mode == ModeAuto {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var f fixture
+			if err := json.Unmarshal(data, &f); err != nil {
+				return nil, fmt.Errorf("llm: invalid fixture %s: %w", path, err)
+			}
+			return f.Response.httpResponse(req), nil
+		}
+		if r.mode == ModeReplay {
+			return errorResponse(req, http.StatusNotFound, "llm: no fixture for request "+hash), nil
+		}
+	}
+
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// Only successful exchanges are worth replaying
+	if resp.StatusCode < 300 {
+		if err := r.save(path, req, body, resp, respBody); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (r *Recorder) save(path string, req *http.Request, body []byte, resp *http.Response, respBody []byte) error {
+	f := fixture{
+		Request: fixtureRequest{Method: req.Method, Path: req.URL.Path, Body: string(body)},
+		Response: fixtureResponse{
+			Status: resp.StatusCode,
+			Header: map[string]string{"Content-Type": resp.Header.Get("Content-Type")},
+		},
+	}
+	if utf8.Valid(respBody) {
+		f.Response.Body = string(respBody)
+	} else {
+		f.Response.BodyBase64 = respBody
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (f fixtureResponse) httpResponse(req *http.Request) *http.Response {
+	body := []byte(f.Body)
+	if f.BodyBase64 != nil {
+		body = f.BodyBase64
+	}
+	header := http.Header{}
+	for k, v := range f.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		StatusCode:    f.Status,
+		Status:        http.StatusText(f.Status),
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// errorResponse builds an API-style error that the SDK will not retry.
+func errorResponse(req *http.Request, status int, msg string) *http.Response {
+	body, _ := json.Marshal(map[string]any{"error": map[string]string{"message": msg, "type": "invalid_request_error"}})
+	return fixtureResponse{
+		Status: status,
+		Header: map[string]string{"Content-Type": "application/json", "X-Should-Retry": "false"},
+		Body:   string(body),
+	}.httpResponse(req)
+}
+
+// readBody reads the request body and restores it for the next reader.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// RequestHash identifies a request independently of host, JSON key order and
+// multipart boundaries.
+func RequestHash(method, path, contentType string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+path+"\n")
+	h.Write(canonicalBody(contentType, body))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func canonicalBody(contentType string, body []byte) []byte {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if mediaType == "multipart/form-data" {
+		if canon, err := canonicalMultipart(body, params["boundary"]); err == nil {
+			return canon
+		}
+		return body
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	canon, err := json.Marshal(v) // map keys are sorted
+	if err != nil {
+		return body
+	}
+	return canon
+}
+
+func canonicalMultipart(body []byte, boundary string) ([]byte, error) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	var fields []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, part.FormName()+"="+string(data))
+	}
+	sort.Strings(fields)
+	var buf bytes.Buffer
+	for _, f := range fields {
+		buf.WriteString(f)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package llm_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	// 录制：请求经由假服务器，响应写入 fixture
+	fake := llm.NewFake(llm.ReplyText("recorded answer"))
+	recorder := llm.NewRecorder(dir, llm.ModeRecord, fake)
+	client, _ := llm.NewClient(&llm.Config{APIKey: "test", Model: "test"}, llm.WithTransport(recorder))
+	if _, err := client.CompletionByParams(llm.UserMessage("what is BTC?")); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 fixture, got %d", len(files))
+	}
+
+	// 回放：不再访问底层 transport
+	replayer := llm.NewRecorder(dir, llm.ModeReplay, http.NewFileTransport(http.Dir(os.DevNull)))
+	client, _ = llm.NewClient(&llm.Config{APIKey: "other", BaseURL: "http://unreachable.invalid/v1", Model: "test"}, llm.WithTransport(replayer))
+	msg, err := client.CompletionByParams(llm.UserMessage("what is BTC?"))
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if msg.Content != "recorded answer" {
+		t.Errorf("Expected recorded answer, got %q", msg.Content)
+	}
+
+	_, err = client.CompletionByParams(llm.UserMessage("something new"))
+	if err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("Expected missing fixture error, got %v", err)
+	}
+}
+
+func TestRequestHashIgnoresKeyOrder(t *testing.T) {
+	a := llm.RequestHash("POST", "/chat/completions", "application/json", []byte(`{"a":1,"b":2}`))
+	b := llm.RequestHash("POST", "/chat/completions", "application/json", []byte(`{"b":2, "a":1}`))
+	if a != b {
+		t.Errorf("Expected equal hashes, got %s and %s", a, b)
+	}
+}
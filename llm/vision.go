@@ -2,57 +2,238 @@ package llm
 
 import (
 	"bytes"
-	"context"
 	"encoding/base64"
+	"fmt"
 	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
 	"image/png"
+	"os"
 
 	"github.com/openai/openai-go"
 )
 
-func (c *LLMClient) vision(img image.Image) (string, error) {
-	return c.visionWithPrompt(img, "Describe this image.")
+// ContentPart is one piece of a multi-part user message: text or an image.
+type ContentPart func(cfg *Config) (openai.ChatCompletionContentPartUnionParam, error)
+
+type imageOptions struct {
+	detail  string
+	maxSize int
+	format  string
+}
+
+// ImageOption configures how an image part is sent.
+type ImageOption func(*imageOptions)
+
+// WithDetail sets the detail level: "low", "high" or "auto".
+func WithDetail(detail string) ImageOption {
+	return func(o *imageOptions) {
+		o.detail = detail
+	}
+}
+
+// WithMaxSize downscales the image so its longest side is at most px pixels.
+func WithMaxSize(px int) ImageOption {
+	return func(o *imageOptions) {
+		o.maxSize = px
+	}
+}
+
+// WithImageFormat sets the encoding: "png" or "jpeg".
+func WithImageFormat(format string) ImageOption {
+	return func(o *imageOptions) {
+		o.format = format
+	}
+}
+
+func newImageOptions(cfg *Config, opts []ImageOption) *imageOptions {
+	o := &imageOptions{
+		detail:  cfg.VisionDetail,
+		maxSize: cfg.VisionMaxSize,
+		format:  cfg.VisionFormat,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.detail == "" {
+		o.detail = "auto"
+	}
+	return o
+}
+
+// TextPart is a text part of a multi-part message.
+func TextPart(text string) ContentPart {
+	return func(*Config) (openai.ChatCompletionContentPartUnionParam, error) {
+		return openai.TextContentPart(text), nil
+	}
+}
+
+// ImagePart encodes an in-memory image, e.g. a rendered kline chart.
+func ImagePart(img image.Image, opts ...ImageOption) ContentPart {
+	return func(cfg *Config) (openai.ChatCompletionContentPartUnionParam, error) {
+		o := newImageOptions(cfg, opts)
+		url, err := encodeImage(img, o)
+		if err != nil {
+			return openai.ChatCompletionContentPartUnionParam{}, err
+		}
+		return imageURLParam(url, o.detail), nil
+	}
+}
+
+// ImageFilePart reads an image from disk. The file is sent unchanged when it
+// is already PNG or JPEG, within the size limit and in the requested format
+// (if one was set with WithImageFormat or Config.VisionFormat).
+func ImageFilePart(path string, opts ...ImageOption) ContentPart {
+	return func(cfg *Config) (openai.ChatCompletionContentPartUnionParam, error) {
+		o := newImageOptions(cfg, opts)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return openai.ChatCompletionContentPartUnionParam{}, err
+		}
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return openai.ChatCompletionContentPartUnionParam{}, fmt.Errorf("decode image %s: %w", path, err)
+		}
+
+		var url string
+		if (format == "png" || format == "jpeg") && !needsResize(img, o.maxSize) && sameFormat(o.format, format) {
+			url = "data:image/" + format + ";base64," + base64.StdEncoding.EncodeToString(data)
+		} else {
+			url, err = encodeImage(img, o)
+			if err != nil {
+				return openai.ChatCompletionContentPartUnionParam{}, err
+			}
+		}
+		return imageURLParam(url, o.detail), nil
+	}
+}
+
+// ImageURLPart references an image by http(s) or data URL. The image is
+// fetched by the provider, so size and format options do not apply.
+func ImageURLPart(url string, opts ...ImageOption) ContentPart {
+	return func(cfg *Config) (openai.ChatCompletionContentPartUnionParam, error) {
+		o := newImageOptions(cfg, opts)
+		return imageURLParam(url, o.detail), nil
+	}
+}
+
+func imageURLParam(url, detail string) openai.ChatCompletionContentPartUnionParam {
+	return openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+		URL:    url,
+		Detail: detail,
+	})
 }
 
-func (c *LLMClient) visionWithPrompt(img image.Image, prompt string) (string, error) {
-	// Encode image to PNG in memory
+// encodeImage downscales img if needed and returns it as a data URL.
+func encodeImage(img image.Image, o *imageOptions) (string, error) {
+	if needsResize(img, o.maxSize) {
+		img = resizeImage(img, o.maxSize)
+	}
+
 	var buf bytes.Buffer
-	if err := png.Encode(&buf, img); err != nil {
+	mimeType := "image/png"
+	switch o.format {
+	case "jpeg", "jpg":
+		mimeType = "image/jpeg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return "", err
+		}
+	case "png", "":
+		if err := png.Encode(&buf, img); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported image format: %s", o.format)
+	}
+
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// sameFormat reports whether a file in format satisfies the requested one;
+// no request accepts any format.
+func sameFormat(requested, format string) bool {
+	if requested == "jpg" {
+		requested = "jpeg"
+	}
+	return requested == "" || requested == format
+}
+
+func needsResize(img image.Image, maxSize int) bool {
+	b := img.Bounds()
+	return maxSize > 0 && (b.Dx() > maxSize || b.Dy() > maxSize)
+}
+
+// resizeImage scales img so its longest side is maxSize, averaging the
+// source pixels covered by each destination pixel.
+func resizeImage(img image.Image, maxSize int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	nw, nh := maxSize, maxSize
+	if w >= h {
+		nh = max(1, h*maxSize/w)
+	} else {
+		nw = max(1, w*maxSize/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := b.Min.Y+y*h/nh, b.Min.Y+max((y+1)*h/nh, y*h/nh+1)
+		for x := 0; x < nw; x++ {
+			x0, x1 := b.Min.X+x*w/nw, b.Min.X+max((x+1)*w/nw, x*w/nw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// Vision analyzes an image and returns a textual description.
+func (c *LLMClient) Vision(img image.Image) (string, error) {
+	return c.VisionWithPrompt(img, "Describe this image.")
+}
+
+// VisionWithPrompt analyzes an image with a custom instruction.
+func (c *LLMClient) VisionWithPrompt(img image.Image, prompt string) (string, error) {
+	return c.VisionWithParts(ImagePart(img), TextPart(prompt))
+}
+
+// VisionWithParts sends several images mixed with text in one request.
+func (c *LLMClient) VisionWithParts(parts ...ContentPart) (string, error) {
+	content, err := contentParts(c.cfg, parts)
+	if err != nil {
 		return "", err
 	}
 
-	imageDataStr := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()) // Placeholder - needs base64 import
-
-	resp, err := c.openai.Chat.Completions.New(
-		context.Background(),
-		openai.ChatCompletionNewParams{
-			Model: c.cfg.VisionModel,
-			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
-					{
-						OfImageURL: &openai.ChatCompletionContentPartImageParam{
-							ImageURL: openai.ChatCompletionContentPartImageImageURLParam{
-								URL:    imageDataStr,
-								Detail: "auto",
-							},
-						},
-					},
-					{
-						OfText: &openai.ChatCompletionContentPartTextParam{
-							Text: prompt,
-						},
-					},
-				}),
-			},
-			Temperature: openai.Float(c.cfg.Temperature),
-			TopP:        openai.Float(c.cfg.TopP),
+	// Same path as CompletionByParams, so guards and the response cache apply
+	msg, err := c.guardedChat(openai.ChatCompletionNewParams{
+		Model: c.cfg.VisionModel,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage(content),
 		},
-	)
+		Temperature: openai.Float(c.cfg.Temperature),
+		TopP:        openai.Float(c.cfg.TopP),
+	}, &callOptions{})
 	if err != nil {
 		return "", err
 	}
-	if len(resp.Choices) == 0 {
-		return "", ErrUnexpectedResponse
+	return msg.Content, nil
+}
+
+func contentParts(cfg *Config, parts []ContentPart) ([]openai.ChatCompletionContentPartUnionParam, error) {
+	content := make([]openai.ChatCompletionContentPartUnionParam, 0, len(parts))
+	for _, part := range parts {
+		p, err := part(cfg)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, p)
 	}
-	return resp.Choices[0].Message.Content, nil
+	return content, nil
 }
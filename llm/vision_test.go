@@ -0,0 +1,106 @@
+package llm_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cai-ki/cage/llm"
+)
+
+func TestVisionWithParts(t *testing.T) {
+	client, requests := newChatServer(t, "uptrend on both timeframes")
+
+	chart := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	path := filepath.Join(t.TempDir(), "chart.png")
+	f, _ := os.Create(path)
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+
+	txt, err := client.VisionWithParts(
+		llm.TextPart("compare these charts"),
+		llm.ImagePart(chart, llm.WithMaxSize(100), llm.WithImageFormat("jpeg"), llm.WithDetail("low")),
+		llm.ImageFilePart(path),
+		llm.ImageURLPart("https://example.com/1h.png", llm.WithDetail("high")),
+	)
+	if err != nil {
+		t.Fatalf("VisionWithParts failed: %v", err)
+	}
+	if txt != "uptrend on both timeframes" {
+		t.Errorf("Unexpected reply: %s", txt)
+	}
+
+	var req struct {
+		Messages []struct {
+			Content []struct {
+				Type     string `json:"type"`
+				ImageURL struct {
+					URL    string `json:"url"`
+					Detail string `json:"detail"`
+				} `json:"image_url"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte((*requests)[0]), &req); err != nil {
+		t.Fatalf("Invalid request body: %v", err)
+	}
+	parts := req.Messages[0].Content
+	if len(parts) != 4 {
+		t.Fatalf("Expected 4 content parts, got %d", len(parts))
+	}
+
+	chartURL := parts[1].ImageURL.URL
+	if !strings.HasPrefix(chartURL, "data:image/jpeg;base64,") || parts[1].ImageURL.Detail != "low" {
+		t.Errorf("Unexpected chart part: %s... detail=%s", chartURL[:30], parts[1].ImageURL.Detail)
+	}
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(chartURL, "data:image/jpeg;base64,"))
+	cfg, err := jpeg.DecodeConfig(strings.NewReader(string(data)))
+	if err != nil || cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("Expected chart downscaled to 100x50, got %dx%d (%v)", cfg.Width, cfg.Height, err)
+	}
+
+	if !strings.HasPrefix(parts[2].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("File part should be sent as PNG data URL")
+	}
+	if parts[3].ImageURL.URL != "https://example.com/1h.png" || parts[3].ImageURL.Detail != "high" {
+		t.Errorf("URL part mismatch: %+v", parts[3].ImageURL)
+	}
+}
+
+func TestVisionFormatGuardsAndCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chart.png")
+	f, _ := os.Create(path)
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+
+	fake := llm.NewFake(llm.ReplyText("flat"))
+	client := fake.Client()
+	llm.WithGuardLogger(func(llm.Intervention) {})(client)
+	client.Use(llm.Redact(nil))
+	client.SetResponseCache(llm.NewLRUResponseCache(10, 0))
+
+	// 请求的格式与文件不同时重新编码；图像请求同样经过 guard 和缓存
+	for i := 0; i < 2; i++ {
+		txt, err := client.VisionWithParts(llm.TextPart("from bob@example.com"), llm.ImageFilePart(path, llm.WithImageFormat("jpeg")))
+		if err != nil || txt != "flat" {
+			t.Fatalf("VisionWithParts failed: %q %v", txt, err)
+		}
+	}
+	requests := fake.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected the second call to be cached, got %d requests", len(requests))
+	}
+	body := string(requests[0].Body)
+	if !strings.Contains(body, "data:image/jpeg;base64,") {
+		t.Error("Expected the PNG file to be re-encoded as JPEG")
+	}
+	if strings.Contains(body, "bob@") {
+		t.Errorf("Expected guards to run on vision requests: %s", body)
+	}
+}
@@ -148,6 +148,9 @@ func FuturesClosePosition(symbol string) (*futures.CreateOrderResponse, error) {
 
 // FuturesGetKlines returns historical futures klines
 func FuturesGetKlines(symbol, interval string, limit int) ([]*futures.Kline, error) {
+	if futuresClient == nil {
+		return nil, errors.New("futures client not initialized")
+	}
 	symbol = standardizeSymbolFutures(symbol)
 	return futuresClient.NewKlinesService().
 		Symbol(symbol).
@@ -156,6 +159,7 @@ func FuturesGetKlines(symbol, interval string, limit int) ([]*futures.Kline, err
 		Do(context.Background())
 }
 
+// FuturesGetTickerPrice returns the mark price from premiumIndex, not the last traded price
 func FuturesGetTickerPrice(symbol string) (string, error) {
 	if futuresClient == nil {
 		return "", errors.New("futures client not initialized")